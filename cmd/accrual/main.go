@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/accrualsim"
+)
+
+// симулятор системы расчета начислений для локального запуска и нагрузочных тестов
+func main() {
+	cfg := config.AccrualConfigInit()
+	logger := loggers.NewLogger()
+	srv := accrualsim.NewServer(accrualsim.Config{
+		Latency:        cfg.Latency,
+		StepDuration:   cfg.StepDuration,
+		InvalidRate:    cfg.InvalidRate,
+		ErrorRate:      cfg.ErrorRate,
+		RateLimit:      cfg.RateLimit,
+		AutoRegister:   cfg.AutoRegister,
+		DefaultAccrual: cfg.DefaultAccrual,
+		Seed:           cfg.Seed,
+	})
+	logger.LogInfo("accrual simulator", cfg.Addr, "started")
+	if err := http.ListenAndServe(cfg.Addr, srv); err != nil {
+		logger.LogErr(err, "accrual simulator stopped")
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"os"
+
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd"
 )
 
 func main() {
+	//gophermart import загружает данные старой системы лояльности, без подкоманды запускается сервер
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		cmd.RunImport(os.Args[2:])
+		return
+	}
 	srv := cmd.NewApp()
 	srv.Start()
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/importer"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/repositories"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/client/postgresql"
+)
+
+// RunImport выполняет команду gophermart import: загружает пользователей, а затем их заказы
+// из файлов миграции. Повторный запуск с теми же файлами продолжает прерванную загрузку.
+func RunImport(args []string) {
+	logger := loggers.NewLogger()
+	cfg, err := config.ImportConfigInit(args)
+	checkError(err, logger)
+	//по сигналу импорт останавливается после текущего пакета
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srvCfg := config.ServerConfig{
+		DatabaseURI:       cfg.DatabaseURI,
+		DBConnectAttempts: cfg.DBConnectAttempts,
+		DBApplicationName: "gophermart-import",
+	}
+	client, err := postgresql.NewClient(ctx, cfg.DBConnectAttempts, &srvCfg, logger)
+	checkError(err, logger)
+	defer client.Close()
+	store, err := repositories.NewPGSStore(client, &srvCfg, logger)
+	checkError(err, logger)
+	report, err := importer.OpenReport(cfg.Rejects)
+	checkError(err, logger)
+	defer report.Close()
+
+	imp := importer.New(store, *logger, report, cfg.BatchSize)
+	for _, file := range []struct{ kind, path string }{
+		{importer.KindUsers, cfg.Users},
+		{importer.KindOrders, cfg.Orders},
+	} {
+		if file.path == "" {
+			continue
+		}
+		stats, err := imp.Run(ctx, file.kind, file.path)
+		logger.LogInfo(file.kind, file.path, fmt.Sprintf("read %d, skipped %d, imported %d, rejected %d",
+			stats.Read, stats.Skipped, stats.Imported, stats.Rejected))
+		if err != nil {
+			logger.LogErr(err, "import is interrupted, run the command again to resume")
+			report.Close()
+			client.Close()
+			os.Exit(1)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -12,9 +15,29 @@ import (
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/agent"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/handlers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/health"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/points"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/repositories"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/stream"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/webhooks"
 	"github.com/CyrilSbrodov/GopherAPIStore/pkg/client/postgresql"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+const (
+	//время, за которое оркестратор должен заметить not ready до остановки сервера
+	shutdownDrainDelay = 5 * time.Second
+	shutdownTimeout    = 10 * time.Second
+	//после этого времени без успешного цикла агент считается неработающим
+	agentMaxCycleAge = time.Minute
+	//количество последних событий, доступных для продолжения потока по Last-Event-ID
+	streamHistorySize = 1000
+	//как часто проверяются партии баллов с истекшим сроком
+	pointsExpiryInterval = time.Hour
+	//как часто снимаются неподтвержденные удержания баллов
+	holdExpiryInterval = time.Minute
 )
 
 type App struct {
@@ -32,12 +55,57 @@ func (a *App) Start() {
 	cfg := config.ServerConfigInit()
 	ticker := time.NewTicker(5 * time.Second)
 
+	//определение провайдера трассировки
+	shutdownTracing, err := tracing.NewProvider(context.Background(), &cfg)
+	checkError(err, logger)
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.LogErr(err, "failed to shutdown tracer provider")
+		}
+	}()
+
 	//определение клиента
-	client, err := postgresql.NewClient(context.Background(), 5, &cfg, logger)
+	client, err := postgresql.NewClient(context.Background(), cfg.DBConnectAttempts, &cfg, logger)
+	checkError(err, logger)
+	//определение клиента реплики для запросов на чтение
+	replica, err := postgresql.NewReplicaClient(context.Background(), cfg.DBConnectAttempts, &cfg, logger)
 	checkError(err, logger)
 	//определение БД
 	store, err := repositories.NewPGSStore(client, &cfg, logger)
 	checkError(err, logger)
+	if replica != nil {
+		store.UseReplica(replica)
+	}
+	//определение шины доменных событий и ретранслятора outbox
+	bus := events.NewBus()
+	if cfg.EventsOutput != "" {
+		w, closeOutput, err := eventsOutput(cfg.EventsOutput)
+		checkError(err, logger)
+		defer closeOutput()
+		bus.Subscribe(events.NewWriterPublisher(w).Publish)
+	}
+	//доставка вебхуков подписчикам
+	bus.Subscribe(webhooks.NewDispatcher(store).Handle)
+	webhookWorker := webhooks.NewWorker(store, *logger)
+	webhookTicker := time.NewTicker(time.Second)
+	go webhookWorker.Start(*webhookTicker)
+	//рассылка событий клиентам всех экземпляров сервиса через LISTEN/NOTIFY
+	hub := stream.NewHub(streamHistorySize)
+	bus.Subscribe(stream.NewNotifier(client).Publish)
+	listenCtx, stopListen := context.WithCancel(context.Background())
+	go stream.Listen(listenCtx, client, hub, *logger)
+	a.server.RegisterOnShutdown(hub.Close)
+	//сгорание баллов с истекшим сроком действия
+	expirer := points.NewExpirer(store, *logger, cfg.PointsExpiryDryRun)
+	expiryTicker := time.NewTicker(pointsExpiryInterval)
+	go expirer.Start(*expiryTicker)
+	holdExpirer := points.NewHoldExpirer(store, *logger)
+	holdTicker := time.NewTicker(holdExpiryInterval)
+	go holdExpirer.Start(*holdTicker)
+
+	relay := events.NewRelay(store, bus, *logger)
+	relayTicker := time.NewTicker(time.Second)
+	go relay.Start(*relayTicker)
 	//определение агента
 	accrualAgent := agent.NewAgent(store, *logger, cfg)
 	//запуск агента в отдельной горутине с тикером
@@ -45,17 +113,72 @@ func (a *App) Start() {
 	//определение куки-хранилища
 	sessionStore := sessions.NewCookieStore([]byte(cfg.SessionKey))
 	//определение хендлера
-	handler := handlers.NewHandler(store, logger, sessionStore)
+	handler := handlers.NewHandler(store, logger, sessionStore, cfg, hub)
 	//регистрация хендлера
 	handler.Register(router)
+	//определение проверок состояния сервиса
+	checker := health.NewChecker()
+	checker.AddCheck("database", true, client.Ping)
+	checker.AddCheck("migrations", true, store.CheckMigrations)
+	checker.AddInfo("database_pool", func() interface{} { return postgresql.Stats(client) })
+	if replica != nil {
+		checker.AddCheck("database_replica", false, replica.Ping)
+		checker.AddInfo("database_replica_pool", func() interface{} { return postgresql.Stats(replica) })
+	}
+	checker.AddCheck("accrual_agent", false, func(ctx context.Context) error {
+		return accrualAgent.Healthy(agentMaxCycleAge)
+	})
+	checker.AddCheck("accrual_circuit", false, accrualAgent.Breaker().Healthy)
+	checker.AddInfo("accrual_circuit", func() interface{} { return accrualAgent.Breaker().Stats() })
+	checker.Register(router)
 	a.server.Addr = cfg.Addr
 	a.server.Handler = router
 
-	logger.LogInfo("server is listen:", cfg.Addr, "start server")
-	if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.LogInfo("server not started:", cfg.Addr, "")
+	go func() {
+		logger.LogInfo("server is listen:", cfg.Addr, "start server")
+		if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			checkError(err, logger)
+		}
+	}()
+
+	//ожидание сигнала на остановку
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+
+	//graceful shutdown: сначала сообщаем о неготовности, затем останавливаем сервер и агента
+	checker.SetShuttingDown()
+	logger.LogInfo("server is shutting down:", cfg.Addr, "")
+	time.Sleep(shutdownDrainDelay)
+	ticker.Stop()
+	accrualAgent.Stop()
+	relayTicker.Stop()
+	webhookTicker.Stop()
+	expiryTicker.Stop()
+	holdTicker.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		logger.LogErr(err, "failed to shutdown server")
+	}
+	stopListen()
+	client.Close()
+	if replica != nil {
+		replica.Close()
+	}
+	logger.LogInfo("server is stopped:", cfg.Addr, "")
+}
+
+// eventsOutput открывает приемник событий: stdout или файл, в который события дописываются.
+func eventsOutput(output string) (io.Writer, func(), error) {
+	if output == "stdout" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
 	}
-	logger.LogInfo("server is listen:", cfg.Addr, "start server")
+	return f, func() { f.Close() }, nil
 }
 
 func checkError(err error, logger *loggers.Logger) {
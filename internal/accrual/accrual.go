@@ -0,0 +1,203 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+var tracer = otel.Tracer("github.com/CyrilSbrodov/GopherAPIStore/internal/accrual")
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+
+	//ограничение на размер ответа, чтобы сломанная система начислений не съела память
+	maxResponseSize = 1 << 16
+	//значение по умолчанию, если система начислений не прислала Retry-After
+	defaultRetryAfter = time.Minute
+)
+
+// ErrNotRegistered — заказ не зарегистрирован в системе расчета начислений (204).
+var ErrNotRegistered = errors.New("order is not registered in accrual system")
+
+// ThrottledError — система начислений ограничила число запросов (429).
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("accrual system throttled requests, retry after %s", e.RetryAfter)
+}
+
+// ServerError — система начислений ответила неожиданным кодом, в том числе 5xx.
+type ServerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("accrual system responded with %d: %s", e.StatusCode, e.Body)
+}
+
+// InvalidResponseError — ответ не прошел проверку: неверный JSON, чужой номер заказа,
+// неизвестный статус или некорректное начисление.
+type InvalidResponseError struct {
+	Reason string
+}
+
+func (e *InvalidResponseError) Error() string {
+	return "invalid accrual response: " + e.Reason
+}
+
+// Response — ответ GET /api/orders/{number}.
+type Response struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+// Validate проверяет ответ на соответствие запрошенному заказу и спецификации.
+func (r Response) Validate(number string) error {
+	if r.Order != number {
+		return &InvalidResponseError{Reason: fmt.Sprintf("order %q does not match requested %q", r.Order, number)}
+	}
+	switch r.Status {
+	case StatusRegistered, StatusInvalid, StatusProcessing:
+		if r.Accrual != nil && *r.Accrual != 0 {
+			return &InvalidResponseError{Reason: fmt.Sprintf("accrual in status %s", r.Status)}
+		}
+	case StatusProcessed:
+		if r.Accrual != nil && *r.Accrual < 0 {
+			return &InvalidResponseError{Reason: "negative accrual"}
+		}
+	default:
+		return &InvalidResponseError{Reason: fmt.Sprintf("unknown status %q", r.Status)}
+	}
+	return nil
+}
+
+// Value возвращает начисление, отсутствующее поле считается нулем.
+func (r Response) Value() float64 {
+	if r.Accrual == nil {
+		return 0
+	}
+	return *r.Accrual
+}
+
+// Client — клиент системы расчета начислений.
+type Client interface {
+	GetOrder(ctx context.Context, number string) (*Response, error)
+}
+
+// HTTPClient ходит в систему начислений по HTTP. Соединения переиспользуются между вызовами,
+// каждый вызов ограничен собственным таймаутом.
+type HTTPClient struct {
+	baseURL string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func NewClient(baseURL string, timeout time.Duration) *HTTPClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 16
+	return &HTTPClient{
+		baseURL: baseURL,
+		timeout: timeout,
+		client:  &http.Client{Transport: transport},
+	}
+}
+
+func (c *HTTPClient) GetOrder(ctx context.Context, number string) (*Response, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	ctx, span := tracer.Start(ctx, "GET /api/orders/{number}",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String(tracing.AttrOrderNumber, number)),
+	)
+	defer span.End()
+
+	resp, err := c.getOrder(ctx, span, number)
+	if err != nil && !errors.Is(err, ErrNotRegistered) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return resp, err
+}
+
+func (c *HTTPClient) getOrder(ctx context.Context, span trace.Span, number string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/orders/"+number, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	//передача контекста трассировки в систему начислений
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, ErrNotRegistered
+	case http.StatusTooManyRequests:
+		return nil, &ThrottledError{RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	default:
+		return nil, &ServerError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result Response
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, &InvalidResponseError{Reason: err.Error()}
+	}
+	if err := result.Validate(number); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// retryAfter разбирает Retry-After в секундах или в формате HTTP-даты.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
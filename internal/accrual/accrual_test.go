@@ -0,0 +1,143 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClient_GetOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		header     map[string]string
+		body       string
+		want       *Response
+		check      func(t *testing.T, err error)
+	}{
+		{
+			name:       "processed",
+			statusCode: http.StatusOK,
+			body:       `{"order":"12345678903","status":"PROCESSED","accrual":500}`,
+			want:       &Response{Order: "12345678903", Status: StatusProcessed, Accrual: func() *float64 { v := 500.0; return &v }()},
+		},
+		{
+			name:       "processing",
+			statusCode: http.StatusOK,
+			body:       `{"order":"12345678903","status":"PROCESSING"}`,
+			want:       &Response{Order: "12345678903", Status: StatusProcessing},
+		},
+		{
+			name:       "not registered",
+			statusCode: http.StatusNoContent,
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrNotRegistered)
+			},
+		},
+		{
+			name:       "throttled",
+			statusCode: http.StatusTooManyRequests,
+			header:     map[string]string{"Retry-After": "60"},
+			body:       "No more than 10 requests per minute allowed",
+			check: func(t *testing.T, err error) {
+				var throttled *ThrottledError
+				assert.ErrorAs(t, err, &throttled)
+				assert.Equal(t, time.Minute, throttled.RetryAfter)
+			},
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusInternalServerError,
+			body:       "internal error",
+			check: func(t *testing.T, err error) {
+				var serverErr *ServerError
+				assert.ErrorAs(t, err, &serverErr)
+				assert.Equal(t, http.StatusInternalServerError, serverErr.StatusCode)
+			},
+		},
+		{
+			name:       "unexpected code",
+			statusCode: http.StatusAccepted,
+			check: func(t *testing.T, err error) {
+				var serverErr *ServerError
+				assert.ErrorAs(t, err, &serverErr)
+			},
+		},
+		{
+			name:       "unknown status",
+			statusCode: http.StatusOK,
+			body:       `{"order":"12345678903","status":"DONE"}`,
+			check:      invalid,
+		},
+		{
+			name:       "other order",
+			statusCode: http.StatusOK,
+			body:       `{"order":"79927398713","status":"PROCESSED","accrual":1}`,
+			check:      invalid,
+		},
+		{
+			name:       "negative accrual",
+			statusCode: http.StatusOK,
+			body:       `{"order":"12345678903","status":"PROCESSED","accrual":-1}`,
+			check:      invalid,
+		},
+		{
+			name:       "broken json",
+			statusCode: http.StatusOK,
+			body:       `{"order":`,
+			check:      invalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/orders/12345678903", r.URL.Path)
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			got, err := NewClient(srv.URL, time.Second).GetOrder(context.Background(), "12345678903")
+			if tt.check != nil {
+				tt.check(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func invalid(t *testing.T, err error) {
+	var invalidErr *InvalidResponseError
+	assert.ErrorAs(t, err, &invalidErr)
+}
+
+func TestHTTPClient_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, 50*time.Millisecond).GetOrder(context.Background(), "12345678903")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_retryAfter(t *testing.T) {
+	assert.Equal(t, defaultRetryAfter, retryAfter(""))
+	assert.Equal(t, 30*time.Second, retryAfter("30"))
+	assert.Equal(t, defaultRetryAfter, retryAfter("soon"))
+	assert.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+}
@@ -0,0 +1,180 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen — запрос не отправлен, потому что система начислений считается недоступной.
+var ErrCircuitOpen = errors.New("accrual circuit breaker is open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type BreakerConfig struct {
+	// FailureThreshold — число ошибок подряд, после которого цепь размыкается.
+	FailureThreshold int
+	// CoolDown — время в разомкнутом состоянии до пробного запроса.
+	CoolDown time.Duration
+}
+
+// Breaker — предохранитель вокруг Client. В разомкнутом состоянии запросы не отправляются,
+// по истечении CoolDown пропускается один пробный запрос: при успехе цепь замыкается,
+// при ошибке снова размыкается.
+type Breaker struct {
+	client Client
+	cfg    BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	opened   int64
+	rejected int64
+}
+
+func NewBreaker(client Client, cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	return &Breaker{client: client, cfg: cfg, now: time.Now}
+}
+
+func (b *Breaker) GetOrder(ctx context.Context, number string) (*Response, error) {
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := b.client.GetOrder(ctx, number)
+	b.record(ctx, err)
+	return resp, err
+}
+
+// Ready сообщает, будет ли пропущен следующий запрос. Состояние предохранителя не меняется.
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		return b.now().Sub(b.openedAt) >= b.cfg.CoolDown
+	case StateHalfOpen:
+		return !b.probing
+	}
+	return true
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Healthy возвращает ошибку, пока цепь разомкнута, для проверки готовности.
+func (b *Breaker) Healthy(ctx context.Context) error {
+	if b.State() == StateOpen {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Stats возвращает состояние и счетчики предохранителя для отчета готовности.
+func (b *Breaker) Stats() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := map[string]interface{}{
+		"state":                b.state.String(),
+		"consecutive_failures": b.failures,
+		"opened_total":         b.opened,
+		"rejected_total":       b.rejected,
+	}
+	if b.state != StateClosed {
+		stats["opened_at"] = b.openedAt
+	}
+	return stats
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.CoolDown {
+			b.rejected++
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		//пока пробный запрос не завершился, остальные не пропускаем
+		if b.probing {
+			b.rejected++
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	//запрос прервала вызывающая сторона: о доступности сервиса он ничего не говорит,
+	//поэтому состояние не меняем, а полуоткрытая цепь ждет следующей пробы
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	if !isFailure(err) {
+		b.state = StateClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		if b.state != StateOpen {
+			b.opened++
+		}
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// isFailure отделяет недоступность системы начислений от штатных ответов: 204, 429
+// и некорректное тело означают, что сервис отвечает.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNotRegistered) {
+		return false
+	}
+	var throttled *ThrottledError
+	var invalid *InvalidResponseError
+	if errors.As(err, &throttled) || errors.As(err, &invalid) {
+		return false
+	}
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
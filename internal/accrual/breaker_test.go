@@ -0,0 +1,131 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clientFunc func(ctx context.Context, number string) (*Response, error)
+
+func (f clientFunc) GetOrder(ctx context.Context, number string) (*Response, error) {
+	return f(ctx, number)
+}
+
+func TestBreaker(t *testing.T) {
+	var calls int
+	var result error
+	b := NewBreaker(clientFunc(func(ctx context.Context, number string) (*Response, error) {
+		calls++
+		return nil, result
+	}), BreakerConfig{FailureThreshold: 2, CoolDown: time.Minute})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	//штатные ответы не размыкают цепь
+	result = &ThrottledError{RetryAfter: time.Second}
+	b.GetOrder(context.Background(), "1")
+	result = ErrNotRegistered
+	b.GetOrder(context.Background(), "1")
+	assert.Equal(t, StateClosed, b.State())
+
+	result = &ServerError{StatusCode: http.StatusInternalServerError}
+	b.GetOrder(context.Background(), "1")
+	assert.Equal(t, StateClosed, b.State())
+	b.GetOrder(context.Background(), "1")
+	assert.Equal(t, StateOpen, b.State())
+	assert.False(t, b.Ready())
+	assert.Error(t, b.Healthy(context.Background()))
+
+	_, err := b.GetOrder(context.Background(), "1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 4, calls)
+
+	//пробный запрос после cool-down снова неудачный
+	now = now.Add(time.Minute)
+	assert.True(t, b.Ready())
+	b.GetOrder(context.Background(), "1")
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, 5, calls)
+
+	//удачный пробный запрос замыкает цепь
+	now = now.Add(time.Minute)
+	result = nil
+	_, err = b.GetOrder(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, b.State())
+	assert.NoError(t, b.Healthy(context.Background()))
+
+	stats := b.Stats()
+	assert.Equal(t, "closed", stats["state"])
+	assert.Equal(t, int64(2), stats["opened_total"])
+	assert.Equal(t, int64(1), stats["rejected_total"])
+}
+
+func TestBreaker_HalfOpenSingleProbe(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var fail = true
+	b := NewBreaker(clientFunc(func(ctx context.Context, number string) (*Response, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		close(started)
+		<-release
+		return &Response{Order: number, Status: StatusProcessing}, nil
+	}), BreakerConfig{FailureThreshold: 1})
+	b.GetOrder(context.Background(), "1")
+	assert.Equal(t, StateOpen, b.State())
+
+	fail = false
+	done := make(chan struct{})
+	go func() {
+		b.GetOrder(context.Background(), "1")
+		close(done)
+	}()
+	<-started
+	assert.Equal(t, StateHalfOpen, b.State())
+	_, err := b.GetOrder(context.Background(), "2")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	close(release)
+	<-done
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreaker_CanceledIsNotFailure(t *testing.T) {
+	b := NewBreaker(clientFunc(func(ctx context.Context, number string) (*Response, error) {
+		return nil, ctx.Err()
+	}), BreakerConfig{FailureThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.GetOrder(ctx, "1")
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreaker_CanceledProbeKeepsHalfOpen(t *testing.T) {
+	var fail = true
+	b := NewBreaker(clientFunc(func(ctx context.Context, number string) (*Response, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return nil, ctx.Err()
+	}), BreakerConfig{FailureThreshold: 1})
+	b.GetOrder(context.Background(), "1")
+	assert.Equal(t, StateOpen, b.State())
+
+	//пробный запрос прерван вызывающей стороной: цепь остается полуоткрытой
+	fail = false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.GetOrder(ctx, "1")
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	b.GetOrder(ctx, "1")
+	assert.Equal(t, StateHalfOpen, b.State())
+}
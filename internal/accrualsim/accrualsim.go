@@ -0,0 +1,292 @@
+package accrualsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+// Config задает поведение симулятора системы расчета начислений.
+type Config struct {
+	// Latency — задержка перед ответом на каждый запрос.
+	Latency time.Duration
+	// StepDuration — время, которое заказ проводит в статусах REGISTERED и PROCESSING.
+	// При нулевом значении заказ сразу получает окончательный статус.
+	StepDuration time.Duration
+	// InvalidRate — доля заказов (от 0 до 1), которые завершатся статусом INVALID.
+	InvalidRate float64
+	// ErrorRate — доля запросов (от 0 до 1), на которые симулятор ответит 500.
+	ErrorRate float64
+	// RateLimit — допустимое число запросов GET /api/orders/{number} в минуту, 0 — без ограничения.
+	RateLimit int
+	// AutoRegister регистрирует неизвестные заказы при первом запросе с начислением DefaultAccrual,
+	// чтобы с симулятором можно было работать без предварительного POST /api/orders.
+	AutoRegister   bool
+	DefaultAccrual float64
+	// Seed инициализирует генератор случайных чисел, чтобы сценарии были воспроизводимы.
+	Seed int64
+}
+
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+type Order struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+type Reward struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+type Response struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+type order struct {
+	accrual      float64
+	invalid      bool
+	registeredAt time.Time
+}
+
+// Server — http.Handler с API системы расчета начислений. Подходит и для отдельного
+// бинарника, и для httptest.NewServer в тестах.
+type Server struct {
+	cfg    Config
+	router *chi.Mux
+	now    func() time.Time
+
+	mu          sync.Mutex
+	rnd         *rand.Rand
+	orders      map[string]*order
+	rewards     []Reward
+	windowStart time.Time
+	windowCount int
+}
+
+func NewServer(cfg Config) *Server {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &Server{
+		cfg:    cfg,
+		router: chi.NewRouter(),
+		now:    time.Now,
+		rnd:    rand.New(rand.NewSource(seed)),
+		orders: make(map[string]*order),
+	}
+	s.router.Use(s.latency)
+	s.router.Post("/api/goods", s.registerReward())
+	s.router.Post("/api/orders", s.registerOrder())
+	s.router.Get("/api/orders/{number}", s.getOrder())
+	return s
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(rw, r)
+}
+
+func (s *Server) latency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if s.cfg.Latency > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(s.cfg.Latency):
+			}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (s *Server) registerReward() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var reward Reward
+		if err := decode(r.Body, &reward); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if reward.Match == "" || reward.Reward <= 0 || (reward.RewardType != RewardPercent && reward.RewardType != RewardPoints) {
+			http.Error(rw, "wrong reward", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, rw2 := range s.rewards {
+			if rw2.Match == reward.Match {
+				http.Error(rw, "reward is already registered", http.StatusConflict)
+				return
+			}
+		}
+		s.rewards = append(s.rewards, reward)
+		rw.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) registerOrder() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var o Order
+		if err := decode(r.Body, &o); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := strconv.ParseUint(o.Order, 10, 64); err != nil {
+			http.Error(rw, "wrong order number", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.orders[o.Order]; ok {
+			http.Error(rw, "order is already registered", http.StatusConflict)
+			return
+		}
+		s.register(o.Order, s.accrual(o.Goods))
+		rw.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *Server) getOrder() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		number := chi.URLParam(r, "number")
+		s.mu.Lock()
+		if retryAfter, ok := s.throttle(); !ok {
+			s.mu.Unlock()
+			rw.Header().Set("Content-Type", "text/plain")
+			rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			rw.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(rw, "No more than %d requests per minute allowed", s.cfg.RateLimit)
+			return
+		}
+		if s.cfg.ErrorRate > 0 && s.rnd.Float64() < s.cfg.ErrorRate {
+			s.mu.Unlock()
+			http.Error(rw, "injected error", http.StatusInternalServerError)
+			return
+		}
+		o, ok := s.orders[number]
+		if !ok && s.cfg.AutoRegister {
+			o = s.register(number, s.cfg.DefaultAccrual)
+			ok = true
+		}
+		var resp Response
+		if ok {
+			resp = s.response(number, o)
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		result, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(result)
+	}
+}
+
+// register вызывается под s.mu. Исход расчета определяется сразу, чтобы ответы были стабильны.
+func (s *Server) register(number string, accrual float64) *order {
+	o := &order{
+		accrual:      accrual,
+		invalid:      s.cfg.InvalidRate > 0 && s.rnd.Float64() < s.cfg.InvalidRate,
+		registeredAt: s.now(),
+	}
+	s.orders[number] = o
+	return o
+}
+
+// accrual считает начисление по первому подходящему правилу для каждого товара.
+func (s *Server) accrual(goods []Good) float64 {
+	var total float64
+	for _, g := range goods {
+		for _, reward := range s.rewards {
+			if !strings.Contains(g.Description, reward.Match) {
+				continue
+			}
+			if reward.RewardType == RewardPercent {
+				total += g.Price * reward.Reward / 100
+			} else {
+				total += reward.Reward
+			}
+			break
+		}
+	}
+	return total
+}
+
+// response вычисляет статус заказа по времени, прошедшему с регистрации:
+// REGISTERED -> PROCESSING -> PROCESSED или INVALID.
+func (s *Server) response(number string, o *order) Response {
+	elapsed := s.now().Sub(o.registeredAt)
+	resp := Response{Order: number}
+	switch {
+	case elapsed < s.cfg.StepDuration:
+		resp.Status = StatusRegistered
+	case elapsed < 2*s.cfg.StepDuration:
+		resp.Status = StatusProcessing
+	case o.invalid:
+		resp.Status = StatusInvalid
+	default:
+		resp.Status = StatusProcessed
+		accrual := o.accrual
+		resp.Accrual = &accrual
+	}
+	return resp
+}
+
+// throttle вызывается под s.mu и считает запросы в окне длиной в минуту.
+// Возвращает false и число секунд до конца окна, если лимит исчерпан.
+func (s *Server) throttle() (int, bool) {
+	if s.cfg.RateLimit <= 0 {
+		return 0, true
+	}
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.cfg.RateLimit {
+		retryAfter := int((time.Minute - now.Sub(s.windowStart) + time.Second - 1) / time.Second)
+		return retryAfter, false
+	}
+	s.windowCount++
+	return 0, true
+}
+
+func decode(body io.ReadCloser, v interface{}) error {
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
@@ -0,0 +1,86 @@
+package accrualsim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func do(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rw
+}
+
+func TestServer_Progression(t *testing.T) {
+	now := time.Now()
+	s := NewServer(Config{StepDuration: time.Second, Seed: 1})
+	s.now = func() time.Time { return now }
+
+	assert.Equal(t, http.StatusOK, do(s, http.MethodPost, "/api/goods", `{"match":"Bork","reward":10,"reward_type":"%"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(s, http.MethodPost, "/api/goods", `{"match":"Bork","reward":5,"reward_type":"pt"}`).Code)
+	assert.Equal(t, http.StatusOK, do(s, http.MethodPost, "/api/goods", `{"match":"Phone","reward":5,"reward_type":"pt"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, http.MethodPost, "/api/goods", `{"match":"Kettle","reward":5,"reward_type":"x"}`).Code)
+
+	order := `{"order":"12345678903","goods":[{"description":"Чайник Bork","price":7000},{"description":"Phone","price":100}]}`
+	assert.Equal(t, http.StatusAccepted, do(s, http.MethodPost, "/api/orders", order).Code)
+	assert.Equal(t, http.StatusConflict, do(s, http.MethodPost, "/api/orders", order).Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, http.MethodPost, "/api/orders", `{"order":"abc"}`).Code)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		status  string
+		accrual *float64
+	}{
+		{"registered", 0, StatusRegistered, nil},
+		{"processing", 1500 * time.Millisecond, StatusProcessing, nil},
+		{"processed", 2 * time.Second, StatusProcessed, func() *float64 { v := 705.0; return &v }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.now = func() time.Time { return now.Add(tt.elapsed) }
+			rw := do(s, http.MethodGet, "/api/orders/12345678903", "")
+			assert.Equal(t, http.StatusOK, rw.Code)
+			var resp Response
+			assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+			assert.Equal(t, tt.status, resp.Status)
+			assert.Equal(t, tt.accrual, resp.Accrual)
+		})
+	}
+
+	assert.Equal(t, http.StatusNoContent, do(s, http.MethodGet, "/api/orders/79927398713", "").Code)
+}
+
+func TestServer_Invalid(t *testing.T) {
+	s := NewServer(Config{InvalidRate: 1, AutoRegister: true, DefaultAccrual: 100})
+	rw := do(s, http.MethodGet, "/api/orders/12345678903", "")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"order":"12345678903","status":"INVALID"}`, rw.Body.String())
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	now := time.Now()
+	s := NewServer(Config{RateLimit: 2, AutoRegister: true})
+	s.now = func() time.Time { return now }
+
+	assert.Equal(t, http.StatusOK, do(s, http.MethodGet, "/api/orders/12345678903", "").Code)
+	assert.Equal(t, http.StatusOK, do(s, http.MethodGet, "/api/orders/12345678903", "").Code)
+	rw := do(s, http.MethodGet, "/api/orders/12345678903", "")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "60", rw.Header().Get("Retry-After"))
+	assert.Equal(t, "No more than 2 requests per minute allowed", rw.Body.String())
+
+	s.now = func() time.Time { return now.Add(time.Minute) }
+	assert.Equal(t, http.StatusOK, do(s, http.MethodGet, "/api/orders/12345678903", "").Code)
+}
+
+func TestServer_Errors(t *testing.T) {
+	s := NewServer(Config{ErrorRate: 1, AutoRegister: true})
+	assert.Equal(t, http.StatusInternalServerError, do(s, http.MethodGet, "/api/orders/12345678903", "").Code)
+}
@@ -1,99 +1,268 @@
 package agent
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/accrual"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+var tracer = otel.Tracer("github.com/CyrilSbrodov/GopherAPIStore/internal/agent")
+
+const (
+	//число заказов, которые экземпляр забирает за один цикл
+	orderBatchSize = 100
+	//срок аренды заказов: за это время цикл должен успеть их обработать,
+	//иначе заказы достанутся другому экземпляру
+	orderLease = time.Minute
 )
 
 type Agent struct {
 	storage.Storage
-	logger loggers.Logger
-	client http.Client
-	cfg    config.ServerConfig
+	logger   loggers.Logger
+	client   accrual.Client
+	breaker  *accrual.Breaker
+	cfg      config.ServerConfig
+	workerID string
+
+	//running не дает Stop снять аренду посреди цикла
+	running sync.Mutex
+	stopped bool
+	//до этого времени система начислений просила не присылать запросы (Retry-After)
+	throttledUntil time.Time
+
+	mu          sync.RWMutex
+	lastSuccess time.Time
+	lastErr     error
 }
 
 func NewAgent(storage storage.Storage, logger loggers.Logger, cfg config.ServerConfig) *Agent {
-	client := &http.Client{}
+	breaker := accrual.NewBreaker(accrual.NewClient(cfg.Accrual, cfg.AccrualTimeout), accrual.BreakerConfig{
+		FailureThreshold: cfg.AccrualBreakerThreshold,
+		CoolDown:         cfg.AccrualBreakerCoolDown,
+	})
 	return &Agent{
-		storage,
-		logger,
-		*client,
-		cfg,
+		Storage:     storage,
+		logger:      logger,
+		client:      breaker,
+		breaker:     breaker,
+		workerID:    workerID(cfg.WorkerID),
+		cfg:         cfg,
+		lastSuccess: time.Now(),
 	}
 }
 
 func (a *Agent) Start(ticker time.Ticker) {
 	//запуск агента в бесконечном цикле
 	for range ticker.C {
-		//получение всех заказов с нужным статусом
-		orders, err := a.Storage.GetAllOrders()
+		a.running.Lock()
+		if a.stopped {
+			a.running.Unlock()
+			return
+		}
+		a.recordCycle(a.cycle())
+		a.running.Unlock()
+	}
+}
+
+func (a *Agent) cycle() error {
+	//пока предохранитель разомкнут, цикл пропускается без запросов в базу и в систему начислений
+	if a.breaker != nil && !a.breaker.Ready() {
+		return accrual.ErrCircuitOpen
+	}
+	//система начислений ответила 429: циклы пропускаются, пока не пройдет Retry-After
+	if until := a.throttledUntil; time.Now().Before(until) {
+		return fmt.Errorf("accrual system throttled requests until %s", until.Format(time.RFC3339))
+	}
+	ctx, span := tracer.Start(context.Background(), "Agent.cycle")
+	defer span.End()
+	//первая ошибка цикла, по ней проверка готовности судит о работе агента
+	var cycleErr error
+	//заказы, которые слишком долго не получают окончательного статуса, больше не проверяются
+	if a.cfg.OrderMaxAge > 0 {
+		failed, err := a.Storage.FailStaleOrders(ctx, a.cfg.OrderMaxAge)
 		if err != nil {
 			a.logger.LogErr(err, "")
+			cycleErr = err
+		} else if failed > 0 {
+			a.logger.LogInfo("orders", strconv.Itoa(failed), "orders marked as failed")
 		}
-		//если новых заказов нет, то ждем опять тикер
-		if orders == nil {
-			continue
+	}
+	//аренда заказов, проверка которых назначена на текущий момент; заказы, взятые
+	//другими экземплярами, пропускаются
+	orders, err := a.Storage.ClaimOrders(ctx, a.workerID, orderBatchSize, orderLease)
+	if err != nil {
+		a.logger.LogErr(err, "")
+		return err
+	}
+	//если новых заказов нет, то ждем опять тикер
+	if orders == nil {
+		return cycleErr
+	}
+	defer a.release(ctx, orders)
+	span.SetAttributes(attribute.Int("orders.count", len(orders)))
+	//получение списка обновленных ореров из внешней системы
+	updatedOrders, checked, err := a.getAccrual(ctx, orders)
+	if err != nil {
+		span.RecordError(err)
+		a.logger.LogErr(err, "")
+		if cycleErr == nil {
+			cycleErr = err
 		}
-		//получение списка обновленных ореров из внешней системы
-		updatedOrders, err := a.GetAccrual(orders)
-		if err != nil {
-			a.logger.LogErr(err, "")
+	}
+	//обновление заказов и начисление вознаграждения
+	if err = Apply(ctx, a.Storage, storage.SourceAgent, updatedOrders); err != nil {
+		a.logger.LogErr(err, "")
+		if cycleErr == nil {
+			cycleErr = err
 		}
-		//обновление заказов в таблице ореров
-		if err = a.Storage.UpdateOrders(updatedOrders); err != nil {
-			a.logger.LogErr(err, "")
+	}
+	//перенос следующей проверки заказов, оставшихся без окончательного статуса
+	if err = a.Storage.RescheduleOrders(ctx, checked); err != nil {
+		a.logger.LogErr(err, "")
+		if cycleErr == nil {
+			cycleErr = err
 		}
-		//обновление суммы вознаграждения в таблице пользователей
-		if err = a.Storage.UpdateUserBalance(updatedOrders); err != nil {
-			a.logger.LogErr(err, "")
+	}
+	return cycleErr
+}
+
+// Apply сохраняет статусы заказов, полученные из системы начислений, и в той же транзакции
+// начисляет вознаграждение по заказам, статус которых действительно изменился. Через него
+// проходят и ответы на опрос агента, и уведомления, присланные системой начислений.
+func Apply(ctx context.Context, s storage.Storage, source string, orders []storage.Orders) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	_, err := s.UpdateOrders(ctx, source, orders)
+	return err
+}
+
+// release снимает аренду с обработанных заказов, чтобы следующая проверка не ждала ее истечения.
+func (a *Agent) release(ctx context.Context, orders []storage.Orders) {
+	numbers := make([]string, 0, len(orders))
+	for _, o := range orders {
+		numbers = append(numbers, o.Order)
+	}
+	if err := a.Storage.ReleaseOrders(ctx, a.workerID, numbers); err != nil {
+		a.logger.LogErr(err, "")
+	}
+}
+
+// Stop дожидается окончания текущего цикла и снимает аренду со всех заказов экземпляра
+// при остановке сервиса.
+func (a *Agent) Stop() {
+	a.running.Lock()
+	defer a.running.Unlock()
+	a.stopped = true
+	if err := a.Storage.ReleaseOrders(context.Background(), a.workerID, nil); err != nil {
+		a.logger.LogErr(err, "failed to release orders")
+	}
+}
+
+func (a *Agent) recordCycle(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastErr = err
+	if err == nil {
+		a.lastSuccess = time.Now()
+	}
+}
+
+// workerID возвращает идентификатор экземпляра для аренды заказов: заданный в конфигурации
+// или собранный из имени хоста, pid и случайного суффикса.
+func workerID(id string) string {
+	if id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Breaker возвращает предохранитель вокруг системы начислений для проверки готовности.
+func (a *Agent) Breaker() *accrual.Breaker {
+	return a.breaker
+}
+
+// Healthy возвращает ошибку, если агент не завершал цикл успешно дольше maxAge.
+func (a *Agent) Healthy(maxAge time.Duration) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if since := time.Since(a.lastSuccess); since > maxAge {
+		if a.lastErr != nil {
+			return fmt.Errorf("last successful cycle %s ago: %w", since.Round(time.Second), a.lastErr)
 		}
+		return fmt.Errorf("last successful cycle %s ago", since.Round(time.Second))
 	}
+	return nil
 }
 
 func (a *Agent) GetAccrual(orders []storage.Orders) ([]storage.Orders, error) {
+	updatedOrders, _, err := a.getAccrual(context.Background(), orders)
+	return updatedOrders, err
+}
+
+// getAccrual возвращает обновленные заказы и номера всех заказов, по которым система начислений
+// ответила по существу: их следующая проверка откладывается.
+func (a *Agent) getAccrual(ctx context.Context, orders []storage.Orders) ([]storage.Orders, []string, error) {
 	var updatedOrders []storage.Orders
+	var checked []string
 	for _, o := range orders {
-		var order storage.Orders
-		req, err := http.NewRequest(http.MethodGet, a.cfg.Accrual+"/api/orders/"+o.Order, nil)
-		if err != nil {
-			a.logger.LogErr(err, "Failed to request")
-			break
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
-
-		resp, err := a.client.Do(req)
-		if err != nil {
-			a.logger.LogErr(err, "Failed to do request")
-			break
-		}
-		res, err := io.ReadAll(resp.Body)
-		if err != nil {
-			a.logger.LogErr(err, "Failed to read body")
-			break
-		}
-		if resp.StatusCode == 429 {
-			return updatedOrders, nil
-		} else if resp.StatusCode == 204 {
+		resp, err := a.getOrder(ctx, o)
+		var throttled *accrual.ThrottledError
+		var invalid *accrual.InvalidResponseError
+		switch {
+		case err == nil:
+		case errors.Is(err, accrual.ErrNotRegistered):
+			checked = append(checked, o.Order)
 			continue
-		} else if resp.StatusCode == 500 {
-			return updatedOrders, fmt.Errorf("error from accrual system")
-		}
-		if err := json.Unmarshal(res, &order); err != nil {
-			a.logger.LogErr(err, "Failed to unmarshal")
-			break
+		case errors.As(err, &throttled):
+			//система начислений просит подождать, остальные заказы обработаем после Retry-After
+			a.logger.LogInfo("retry after", throttled.RetryAfter.String(), "accrual system throttled requests")
+			a.throttledUntil = time.Now().Add(throttled.RetryAfter)
+			return updatedOrders, checked, nil
+		case errors.As(err, &invalid):
+			//некорректный ответ по одному заказу не должен останавливать остальные
+			a.logger.LogErr(err, "order "+o.Order)
+			checked = append(checked, o.Order)
+			continue
+		default:
+			return updatedOrders, checked, err
 		}
-		order.Order = o.Order
-		order.UserID = o.UserID
-		updatedOrders = append(updatedOrders, order)
-		resp.Body.Close()
+		checked = append(checked, o.Order)
+		updatedOrders = append(updatedOrders, storage.Orders{
+			UserID:  o.UserID,
+			Order:   o.Order,
+			Status:  resp.Status,
+			Accrual: resp.Value(),
+		})
 	}
-	return updatedOrders, nil
+	return updatedOrders, checked, nil
+}
+
+// getOrder запрашивает заказ в системе начислений в отдельном спане с идентификатором пользователя.
+func (a *Agent) getOrder(ctx context.Context, o storage.Orders) (*accrual.Response, error) {
+	ctx, span := tracer.Start(ctx, "Agent.getOrder")
+	defer span.End()
+	span.SetAttributes(attribute.Int(tracing.AttrUserID, o.UserID))
+	return a.client.GetOrder(ctx, o.Order)
 }
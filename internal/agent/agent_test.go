@@ -6,24 +6,31 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/accrual"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/accrualsim"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
 )
 
 func TestAgent_GetAccrual(t *testing.T) {
 
-	client := http.Client{}
 	logger := loggers.NewLogger()
 	cfg := config.ServerConfigInit()
+	accrual500 := 500.0
 
 	type fields struct {
 		Storage storage.Storage
 		logger  loggers.Logger
-		client  http.Client
 		cfg     config.ServerConfig
 	}
 	type args struct {
@@ -32,13 +39,13 @@ func TestAgent_GetAccrual(t *testing.T) {
 	type expected struct {
 		orders     []storage.Orders
 		statusCode int
-		err        error
+		wantErr    bool
 	}
 	tests := []struct {
 		name     string
 		fields   fields
 		args     args
-		answer   storage.Orders
+		answer   accrual.Response
 		expected expected
 	}{
 		{
@@ -46,7 +53,6 @@ func TestAgent_GetAccrual(t *testing.T) {
 			fields: fields{
 				Storage: nil,
 				logger:  *logger,
-				client:  client,
 				cfg:     cfg,
 			},
 			args: args{orders: []storage.Orders{
@@ -64,12 +70,11 @@ func TestAgent_GetAccrual(t *testing.T) {
 					},
 				},
 				statusCode: 200,
-				err:        nil,
 			},
-			answer: storage.Orders{
+			answer: accrual.Response{
 				Order:   "12345678903",
 				Status:  "PROCESSED",
-				Accrual: 500,
+				Accrual: &accrual500,
 			},
 		},
 		{
@@ -77,7 +82,6 @@ func TestAgent_GetAccrual(t *testing.T) {
 			fields: fields{
 				Storage: nil,
 				logger:  *logger,
-				client:  client,
 				cfg:     cfg,
 			},
 			args: args{orders: []storage.Orders{
@@ -89,12 +93,11 @@ func TestAgent_GetAccrual(t *testing.T) {
 			expected: expected{
 				orders:     nil,
 				statusCode: http.StatusTooManyRequests,
-				err:        nil,
 			},
-			answer: storage.Orders{
+			answer: accrual.Response{
 				Order:   "12345678903",
 				Status:  "PROCESSED",
-				Accrual: 500,
+				Accrual: &accrual500,
 			},
 		},
 		{
@@ -102,7 +105,6 @@ func TestAgent_GetAccrual(t *testing.T) {
 			fields: fields{
 				Storage: nil,
 				logger:  *logger,
-				client:  client,
 				cfg:     cfg,
 			},
 			args: args{orders: []storage.Orders{
@@ -114,9 +116,9 @@ func TestAgent_GetAccrual(t *testing.T) {
 			expected: expected{
 				orders:     nil,
 				statusCode: http.StatusInternalServerError,
-				err:        fmt.Errorf("error from accrual system"),
+				wantErr:    true,
 			},
-			answer: storage.Orders{},
+			answer: accrual.Response{},
 		},
 	}
 
@@ -125,7 +127,6 @@ func TestAgent_GetAccrual(t *testing.T) {
 			a := &Agent{
 				Storage: tt.fields.Storage,
 				logger:  tt.fields.logger,
-				client:  tt.fields.client,
 				cfg:     tt.fields.cfg,
 			}
 			ordersJSON, err := json.Marshal(tt.answer)
@@ -136,11 +137,176 @@ func TestAgent_GetAccrual(t *testing.T) {
 				w.Write(ordersJSON)
 			}))
 			defer srv.Close()
-			a.cfg.Accrual = srv.URL
+			a.client = accrual.NewClient(srv.URL, time.Second)
 
 			got, err := a.GetAccrual(tt.args.orders)
-			assert.Equal(t, tt.expected.err, err)
+			if tt.expected.wantErr {
+				var serverErr *accrual.ServerError
+				assert.ErrorAs(t, err, &serverErr)
+			} else {
+				assert.NoError(t, err)
+			}
 			assert.Equal(t, tt.expected.orders, got)
 		})
 	}
 }
+
+func TestAgent_GetAccrualPropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	a := &Agent{
+		logger: *loggers.NewLogger(),
+		client: accrual.NewClient(srv.URL, time.Second),
+	}
+	_, err := a.GetAccrual([]storage.Orders{{Order: "12345678903"}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, traceparent)
+}
+
+func TestAgent_Healthy(t *testing.T) {
+	a := &Agent{lastSuccess: time.Now()}
+	assert.NoError(t, a.Healthy(time.Minute))
+
+	a.recordCycle(fmt.Errorf("error from accrual system"))
+	assert.NoError(t, a.Healthy(time.Minute))
+
+	a.lastSuccess = time.Now().Add(-2 * time.Minute)
+	assert.Error(t, a.Healthy(time.Minute))
+
+	a.recordCycle(nil)
+	assert.NoError(t, a.Healthy(time.Minute))
+}
+
+func TestAgent_GetAccrualSimulator(t *testing.T) {
+	sim := accrualsim.NewServer(accrualsim.Config{RateLimit: 2, AutoRegister: true, DefaultAccrual: 500})
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+
+	a := &Agent{
+		logger: *loggers.NewLogger(),
+		client: accrual.NewClient(srv.URL, time.Second),
+	}
+	orders := []storage.Orders{{Order: "12345678903", UserID: 1}, {Order: "79927398713", UserID: 2}, {Order: "4561261212345467", UserID: 3}}
+	updated, err := a.GetAccrual(orders)
+	assert.NoError(t, err)
+	//третий запрос упирается в ограничение 429, агент возвращает уже полученные заказы
+	assert.Equal(t, []storage.Orders{
+		{Order: "12345678903", UserID: 1, Status: accrualsim.StatusProcessed, Accrual: 500},
+		{Order: "79927398713", UserID: 2, Status: accrualsim.StatusProcessed, Accrual: 500},
+	}, updated)
+}
+
+func TestAgent_GetAccrualErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockClient(ctrl)
+
+	accrual300 := 300.0
+	client.EXPECT().GetOrder(gomock.Any(), "1").Return(nil, accrual.ErrNotRegistered)
+	client.EXPECT().GetOrder(gomock.Any(), "2").Return(nil, &accrual.InvalidResponseError{Reason: "unknown status"})
+	client.EXPECT().GetOrder(gomock.Any(), "3").Return(&accrual.Response{Order: "3", Status: accrual.StatusProcessed, Accrual: &accrual300}, nil)
+	client.EXPECT().GetOrder(gomock.Any(), "4").Return(nil, &accrual.ThrottledError{RetryAfter: time.Minute})
+
+	a := &Agent{logger: *loggers.NewLogger(), client: client}
+	got, err := a.GetAccrual([]storage.Orders{{Order: "1"}, {Order: "2"}, {Order: "3", UserID: 7}, {Order: "4"}, {Order: "5"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Orders{{Order: "3", UserID: 7, Status: accrual.StatusProcessed, Accrual: 300}}, got)
+
+	client.EXPECT().GetOrder(gomock.Any(), "6").Return(nil, fmt.Errorf("connection refused"))
+	_, err = a.GetAccrual([]storage.Orders{{Order: "6"}, {Order: "7"}})
+	assert.Error(t, err)
+}
+
+func TestAgent_CycleSkippedWhileCircuitOpen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockClient(ctrl)
+	store := mocks.NewMockStorage(ctrl)
+
+	breaker := accrual.NewBreaker(client, accrual.BreakerConfig{FailureThreshold: 1, CoolDown: time.Hour})
+	a := &Agent{Storage: store, logger: *loggers.NewLogger(), client: breaker, breaker: breaker, workerID: "w1"}
+
+	store.EXPECT().ClaimOrders(gomock.Any(), "w1", orderBatchSize, orderLease).Return([]storage.Orders{{Order: "1"}, {Order: "2"}}, nil)
+	client.EXPECT().GetOrder(gomock.Any(), "1").Return(nil, &accrual.ServerError{StatusCode: http.StatusBadGateway})
+	store.EXPECT().RescheduleOrders(gomock.Any(), gomock.Any()).Return(nil)
+	store.EXPECT().ReleaseOrders(gomock.Any(), "w1", []string{"1", "2"}).Return(nil)
+	assert.Error(t, a.cycle())
+	assert.Equal(t, accrual.StateOpen, breaker.State())
+
+	//следующий цикл не обращается ни к базе, ни к системе начислений
+	assert.ErrorIs(t, a.cycle(), accrual.ErrCircuitOpen)
+}
+
+func TestAgent_CycleReschedulesCheckedOrders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockClient(ctrl)
+	store := mocks.NewMockStorage(ctrl)
+	a := &Agent{Storage: store, logger: *loggers.NewLogger(), client: client, cfg: config.ServerConfig{OrderMaxAge: time.Hour}, workerID: "w1"}
+
+	accrual100 := 100.0
+	store.EXPECT().FailStaleOrders(gomock.Any(), time.Hour).Return(1, nil)
+	store.EXPECT().ClaimOrders(gomock.Any(), "w1", orderBatchSize, orderLease).Return([]storage.Orders{{Order: "1", UserID: 1}, {Order: "2", UserID: 1}, {Order: "3", UserID: 2}}, nil)
+	client.EXPECT().GetOrder(gomock.Any(), "1").Return(&accrual.Response{Order: "1", Status: accrual.StatusProcessing}, nil)
+	client.EXPECT().GetOrder(gomock.Any(), "2").Return(nil, accrual.ErrNotRegistered)
+	client.EXPECT().GetOrder(gomock.Any(), "3").Return(&accrual.Response{Order: "3", Status: accrual.StatusProcessed, Accrual: &accrual100}, nil)
+	updated := []storage.Orders{
+		{Order: "1", UserID: 1, Status: accrual.StatusProcessing},
+		{Order: "3", UserID: 2, Status: accrual.StatusProcessed, Accrual: 100},
+	}
+	store.EXPECT().UpdateOrders(gomock.Any(), storage.SourceAgent, updated).Return(updated[1:], nil)
+	//заказы, по которым система ответила, откладываются независимо от результата
+	store.EXPECT().RescheduleOrders(gomock.Any(), []string{"1", "2", "3"}).Return(nil)
+	store.EXPECT().ReleaseOrders(gomock.Any(), "w1", []string{"1", "2", "3"}).Return(nil)
+	assert.NoError(t, a.cycle())
+}
+
+func TestAgent_CycleSkippedWhileThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mocks.NewMockClient(ctrl)
+	store := mocks.NewMockStorage(ctrl)
+	a := &Agent{Storage: store, logger: *loggers.NewLogger(), client: client, workerID: "w1"}
+
+	store.EXPECT().ClaimOrders(gomock.Any(), "w1", orderBatchSize, orderLease).Return([]storage.Orders{{Order: "1"}, {Order: "2"}}, nil)
+	client.EXPECT().GetOrder(gomock.Any(), "1").Return(nil, &accrual.ThrottledError{RetryAfter: time.Minute})
+	store.EXPECT().RescheduleOrders(gomock.Any(), gomock.Any()).Return(nil)
+	store.EXPECT().ReleaseOrders(gomock.Any(), "w1", []string{"1", "2"}).Return(nil)
+	assert.NoError(t, a.cycle())
+	assert.WithinDuration(t, time.Now().Add(time.Minute), a.throttledUntil, time.Second)
+
+	//до истечения Retry-After цикл не обращается ни к базе, ни к системе начислений
+	assert.Error(t, a.cycle())
+
+	a.throttledUntil = time.Now().Add(-time.Second)
+	store.EXPECT().ClaimOrders(gomock.Any(), "w1", orderBatchSize, orderLease).Return(nil, nil)
+	assert.NoError(t, a.cycle())
+}
+
+func TestAgent_Stop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mocks.NewMockStorage(ctrl)
+	a := &Agent{Storage: store, logger: *loggers.NewLogger(), workerID: "w1"}
+
+	store.EXPECT().ReleaseOrders(gomock.Any(), "w1", nil).Return(nil)
+	a.Stop()
+
+	//тик, оставшийся в канале после остановки, не запускает цикл
+	tick := make(chan time.Time, 1)
+	tick <- time.Now()
+	a.Start(time.Ticker{C: tick})
+}
+
+func Test_workerID(t *testing.T) {
+	assert.Equal(t, "replica-1", workerID("replica-1"))
+	assert.NotEqual(t, workerID(""), workerID(""))
+}
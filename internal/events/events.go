@@ -0,0 +1,145 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SchemaVersion — версия схемы событий. Увеличивается при несовместимом изменении полезной нагрузки,
+// чтобы потребители могли различать старый и новый формат.
+const SchemaVersion = 1
+
+const (
+	TypeOrderStatusChanged = "order.status_changed"
+	TypeOrderProcessed     = "order.processed"
+	TypeBalanceWithdrawn   = "balance.withdrawn"
+	TypeBalanceUpdated     = "balance.updated"
+	TypePointsExpired      = "points.expired"
+	TypeTierChanged        = "tier.changed"
+	TypeBalanceTransferred = "balance.transferred"
+	TypeBalanceRefunded    = "balance.refunded"
+	TypeBalanceClawedBack  = "balance.clawed_back"
+)
+
+// Types возвращает все известные типы событий.
+func Types() []string {
+	return []string{
+		TypeOrderStatusChanged, TypeOrderProcessed, TypeBalanceWithdrawn, TypeBalanceUpdated,
+		TypePointsExpired, TypeTierChanged, TypeBalanceTransferred, TypeBalanceRefunded,
+		TypeBalanceClawedBack,
+	}
+}
+
+// IsKnownType проверяет, что тип события поддерживается.
+func IsKnownType(eventType string) bool {
+	for _, t := range Types() {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event — доменное событие в том виде, в котором оно хранится в outbox и уходит потребителям.
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	AggregateID string          `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+type OrderStatusChanged struct {
+	UserID    int     `json:"user_id"`
+	Order     string  `json:"order"`
+	OldStatus string  `json:"old_status"`
+	Status    string  `json:"status"`
+	Accrual   float64 `json:"accrual"`
+}
+
+type OrderProcessed struct {
+	UserID  int     `json:"user_id"`
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual"`
+}
+
+type BalanceWithdrawn struct {
+	UserID int     `json:"user_id"`
+	Order  string  `json:"order"`
+	Sum    float64 `json:"sum"`
+}
+
+type BalanceUpdated struct {
+	UserID    int     `json:"user_id"`
+	Accrued   float64 `json:"accrued"`
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+type PointsExpired struct {
+	UserID    int     `json:"user_id"`
+	Amount    float64 `json:"amount"`
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+// BalanceTransferred пишется отдельно для отправителя и получателя; UserID — сторона,
+// которой адресовано событие.
+type BalanceTransferred struct {
+	UserID      int     `json:"user_id"`
+	TransferID  int64   `json:"transfer_id"`
+	SenderID    int     `json:"sender_id"`
+	RecipientID int     `json:"recipient_id"`
+	Amount      float64 `json:"amount"`
+}
+
+type BalanceRefunded struct {
+	RefundID int64   `json:"refund_id"`
+	UserID   int     `json:"user_id"`
+	Order    string  `json:"order"`
+	Sum      float64 `json:"sum"`
+}
+
+type BalanceClawedBack struct {
+	UserID  int     `json:"user_id"`
+	Order   string  `json:"order"`
+	Amount  float64 `json:"amount"`
+	Current float64 `json:"current"`
+	Debt    float64 `json:"debt"`
+}
+
+type TierChanged struct {
+	UserID        int     `json:"user_id"`
+	OldTier       string  `json:"old_tier"`
+	Tier          string  `json:"tier"`
+	RollingPoints float64 `json:"rolling_points"`
+}
+
+// NewEvent сериализует полезную нагрузку и заполняет служебные поля события.
+func NewEvent(eventType, aggregateID string, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:        eventType,
+		Version:     SchemaVersion,
+		AggregateID: aggregateID,
+		Payload:     data,
+		OccurredAt:  time.Now(),
+	}, nil
+}
+
+// UserID извлекает идентификатор пользователя из полезной нагрузки события.
+// Все события пользовательского уровня содержат поле user_id.
+func (e Event) UserID() (int, error) {
+	var p struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.Unmarshal(e.Payload, &p); err != nil {
+		return 0, err
+	}
+	return p.UserID, nil
+}
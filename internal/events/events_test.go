@@ -0,0 +1,102 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+)
+
+type fakeOutbox struct {
+	pending   []Event
+	published []int64
+	failed    []int64
+}
+
+func (f *fakeOutbox) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]Event, error) {
+	if len(f.pending) > limit {
+		batch := f.pending[:limit]
+		f.pending = f.pending[limit:]
+		return batch, nil
+	}
+	batch := f.pending
+	f.pending = nil
+	return batch, nil
+}
+
+func (f *fakeOutbox) MarkPublished(ctx context.Context, id int64) error {
+	f.published = append(f.published, id)
+	return nil
+}
+
+func (f *fakeOutbox) MarkFailed(ctx context.Context, id int64, cause error, maxAttempts int) error {
+	f.failed = append(f.failed, id)
+	return nil
+}
+
+func TestNewEvent(t *testing.T) {
+	e, err := NewEvent(TypeOrderProcessed, "12345678903", OrderProcessed{
+		UserID:  1,
+		Order:   "12345678903",
+		Status:  "PROCESSED",
+		Accrual: 500,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, e.Version)
+	assert.Equal(t, "12345678903", e.AggregateID)
+	assert.JSONEq(t, `{"user_id":1,"order":"12345678903","status":"PROCESSED","accrual":500}`, string(e.Payload))
+}
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	var got []int64
+	bus.Subscribe(func(ctx context.Context, e Event) error {
+		got = append(got, e.ID)
+		return nil
+	})
+	bus.Subscribe(func(ctx context.Context, e Event) error {
+		return errors.New("subscriber is down")
+	})
+	err := bus.Publish(context.Background(), Event{ID: 1})
+	assert.Error(t, err)
+	assert.Equal(t, []int64{1}, got)
+}
+
+func TestWriterPublisher_Publish(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWriterPublisher(&buf)
+	assert.NoError(t, p.Publish(context.Background(), Event{ID: 1, Type: TypeBalanceWithdrawn}))
+	assert.NoError(t, p.Publish(context.Background(), Event{ID: 2, Type: TypeBalanceWithdrawn}))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	var e Event
+	assert.NoError(t, json.Unmarshal(lines[1], &e))
+	assert.Equal(t, int64(2), e.ID)
+}
+
+func TestRelay_Flush(t *testing.T) {
+	store := &fakeOutbox{}
+	for i := 1; i <= relayBatchSize+1; i++ {
+		store.pending = append(store.pending, Event{ID: int64(i)})
+	}
+	bus := NewBus()
+	bus.Subscribe(func(ctx context.Context, e Event) error {
+		if e.ID == 2 {
+			return errors.New("temporary error")
+		}
+		return nil
+	})
+	relay := NewRelay(store, bus, *loggers.NewLogger())
+	relay.Flush(context.Background())
+
+	assert.Len(t, store.published, relayBatchSize)
+	assert.Equal(t, []int64{2}, store.failed)
+	assert.Empty(t, store.pending)
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Publisher доставляет событие потребителям. Ошибка означает, что событие нужно отправить повторно.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+type Handler func(ctx context.Context, e Event) error
+
+// Bus — внутрипроцессный издатель, раздающий события всем подписчикам.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish вызывает всех подписчиков и возвращает первую ошибку.
+// Подписчики должны быть идемпотентны: при ошибке событие будет доставлено всем повторно.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := make([]Handler, len(b.handlers))
+	copy(handlers, b.handlers)
+	b.mu.RUnlock()
+
+	var firstErr error
+	for _, h := range handlers {
+		if err := h(ctx, e); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WriterPublisher пишет события построчно в JSON, например в файл или stdout.
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+func (p *WriterPublisher) Publish(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(append(data, '\n'))
+	return err
+}
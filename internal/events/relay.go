@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+)
+
+const (
+	relayBatchSize = 100
+	//время, на которое событие закрепляется за экземпляром сервиса на время отправки
+	relayLease = time.Minute
+	//после стольких неудачных попыток событие больше не отправляется и ждет разбора
+	MaxAttempts = 20
+)
+
+// OutboxStore — хранилище неотправленных событий.
+type OutboxStore interface {
+	// ClaimEvents забирает до limit готовых к отправке событий. Забранные события
+	// не выдаются другим экземплярам сервиса, пока не истечет lease.
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]Event, error)
+	MarkPublished(ctx context.Context, id int64) error
+	// MarkFailed сохраняет ошибку и откладывает следующую попытку с экспоненциальной задержкой;
+	// после maxAttempts попыток событие больше не выдается.
+	MarkFailed(ctx context.Context, id int64, cause error, maxAttempts int) error
+}
+
+// Relay переносит события из outbox к издателю. Событие помечается отправленным только
+// после успешной публикации, поэтому доставка гарантируется как at-least-once.
+type Relay struct {
+	store     OutboxStore
+	publisher Publisher
+	logger    loggers.Logger
+}
+
+func NewRelay(store OutboxStore, publisher Publisher, logger loggers.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		logger:    logger,
+	}
+}
+
+func (r *Relay) Start(ticker time.Ticker) {
+	for range ticker.C {
+		r.Flush(context.Background())
+	}
+}
+
+// Flush отправляет все накопившиеся события пачками.
+func (r *Relay) Flush(ctx context.Context) {
+	for {
+		batch, err := r.store.ClaimEvents(ctx, relayBatchSize, relayLease)
+		if err != nil {
+			r.logger.LogErr(err, "failed to claim outbox events")
+			return
+		}
+		for _, e := range batch {
+			r.publish(ctx, e)
+		}
+		if len(batch) < relayBatchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, e Event) {
+	if err := r.publisher.Publish(ctx, e); err != nil {
+		r.logger.LogErr(err, "failed to publish event "+strconv.FormatInt(e.ID, 10))
+		if err = r.store.MarkFailed(ctx, e.ID, err, MaxAttempts); err != nil {
+			r.logger.LogErr(err, "failed to mark event as failed")
+		}
+		return
+	}
+	if err := r.store.MarkPublished(ctx, e.ID); err != nil {
+		r.logger.LogErr(err, "failed to mark event as published")
+	}
+}
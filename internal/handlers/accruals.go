@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/accrual"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/agent"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/webhooks"
+)
+
+const (
+	HeaderAccrualTimestamp = "X-Accrual-Timestamp"
+	HeaderAccrualSignature = "X-Accrual-Signature"
+
+	//допустимое расхождение метки времени уведомления с часами сервера
+	accrualPushTolerance = 5 * time.Minute
+	//ограничение на размер пачки уведомлений
+	maxAccrualPushSize = 1 << 20
+)
+
+// AccrualAuth проверяет подпись уведомлений системы начислений: HMAC-SHA256 от
+// "<timestamp>.<body>" с общим секретом, как у исходящих вебхуков. Если секрет не задан,
+// прием уведомлений отключен.
+func (h *Handler) AccrualAuth(next http.Handler) http.Handler {
+	return signedAuth(h.cfg.AccrualPushSecret, HeaderAccrualTimestamp, HeaderAccrualSignature, next)
+}
+
+// signedAuth пропускает запросы, подписанные секретом secret. Метка времени и подпись
+// передаются в заголовках tsHeader и sigHeader. Пустой секрет отключает обработчик.
+func signedAuth(secret, tsHeader, sigHeader string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if secret == "" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxAccrualPushSize+1))
+		r.Body.Close()
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxAccrualPushSize {
+			rw.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		timestamp := r.Header.Get(tsHeader)
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		//старые запросы отклоняются, чтобы перехваченный запрос нельзя было повторить
+		if d := time.Since(time.Unix(unix, 0)); d > accrualPushTolerance || d < -accrualPushTolerance {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		expected := webhooks.Sign(secret, timestamp, body)
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get(sigHeader))) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// PushAccruals принимает от системы начислений одно уведомление {order, status, accrual}
+// или их массив и применяет их тем же путем, что и опрос агента. Заказы, о которых система
+// не сообщила, по-прежнему проверяются агентом.
+func (h *Handler) PushAccruals() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		var notifications []accrual.Response
+		content = bytes.TrimSpace(content)
+		if len(content) > 0 && content[0] == '[' {
+			err = json.Unmarshal(content, &notifications)
+		} else {
+			var n accrual.Response
+			err = json.Unmarshal(content, &n)
+			notifications = append(notifications, n)
+		}
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		//пачка применяется целиком, поэтому проверяется до записи
+		orders := make([]storage.Orders, 0, len(notifications))
+		numbers := make([]string, 0, len(notifications))
+		for _, n := range notifications {
+			if n.Order == "" {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("empty order number"))
+				return
+			}
+			if err = n.Validate(n.Order); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+			orders = append(orders, storage.Orders{Order: n.Order, Status: n.Status, Accrual: n.Value()})
+			numbers = append(numbers, n.Order)
+		}
+
+		if err = agent.Apply(r.Context(), h.Storage, storage.SourcePush, orders); err != nil {
+			h.logger.LogErr(err, "failed to apply accruals")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		//следующий опрос этих заказов откладывается: система уже сообщила о них сама
+		if err = h.Storage.RescheduleOrders(r.Context(), numbers); err != nil {
+			h.logger.LogErr(err, "")
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
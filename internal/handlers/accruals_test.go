@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/webhooks"
+)
+
+func signedAccrualRequest(secret, body string, at time.Time) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req, _ := http.NewRequest(http.MethodPost, "/internal/accruals", bytes.NewBufferString(body))
+	req.Header.Set(HeaderAccrualTimestamp, timestamp)
+	req.Header.Set(HeaderAccrualSignature, webhooks.Sign(secret, timestamp, []byte(body)))
+	return req
+}
+
+func TestHandler_AccrualAuth(t *testing.T) {
+	body := `{"order":"12345678903","status":"PROCESSED","accrual":500}`
+	tests := []struct {
+		name         string
+		secret       string
+		req          *http.Request
+		expectedCode int
+	}{
+		{
+			name:         "valid signature",
+			secret:       "secret",
+			req:          signedAccrualRequest("secret", body, time.Now()),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "wrong secret",
+			secret:       "secret",
+			req:          signedAccrualRequest("other", body, time.Now()),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "stale timestamp",
+			secret:       "secret",
+			req:          signedAccrualRequest("secret", body, time.Now().Add(-time.Hour)),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "push disabled",
+			secret:       "",
+			req:          signedAccrualRequest("", body, time.Now()),
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				logger: *loggers.NewLogger(),
+				cfg:    config.ServerConfig{AccrualPushSecret: tt.secret},
+			}
+			var got []byte
+			next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				got, _ = io.ReadAll(r.Body)
+				rw.WriteHeader(http.StatusOK)
+			})
+			rec := httptest.NewRecorder()
+			h.AccrualAuth(next).ServeHTTP(rec, tt.req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				//тело после проверки подписи доступно обработчику
+				assert.Equal(t, body, string(got))
+			}
+		})
+	}
+}
+
+func TestHandler_PushAccruals(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		orders       []storage.Orders
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "single",
+			body:         `{"order":"12345678903","status":"PROCESSED","accrual":500}`,
+			orders:       []storage.Orders{{Order: "12345678903", Status: "PROCESSED", Accrual: 500}},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "batch",
+			body: `[{"order":"12345678903","status":"PROCESSED","accrual":500},{"order":"79927398713","status":"INVALID"}]`,
+			orders: []storage.Orders{
+				{Order: "12345678903", Status: "PROCESSED", Accrual: 500},
+				{Order: "79927398713", Status: "INVALID"},
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unknown status",
+			body:         `[{"order":"12345678903","status":"PROCESSED","accrual":500},{"order":"79927398713","status":"DONE"}]`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "empty order",
+			body:         `{"status":"PROCESSED","accrual":500}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "broken json",
+			body:         `{"order":`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "storage error",
+			body:         `{"order":"12345678903","status":"PROCESSED","accrual":500}`,
+			orders:       []storage.Orders{{Order: "12345678903", Status: "PROCESSED", Accrual: 500}},
+			errFromDB:    errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage: s,
+				logger:  *loggers.NewLogger(),
+			}
+			if tt.orders != nil {
+				//начисление идет тем же путем, что и у агента, в транзакции смены статуса
+				changed := []storage.Orders{{UserID: 1, Order: tt.orders[0].Order, Status: tt.orders[0].Status, Accrual: tt.orders[0].Accrual}}
+				s.EXPECT().UpdateOrders(gomock.Any(), storage.SourcePush, tt.orders).Return(changed, tt.errFromDB)
+				if tt.errFromDB == nil {
+					numbers := make([]string, 0, len(tt.orders))
+					for _, o := range tt.orders {
+						numbers = append(numbers, o.Order)
+					}
+					s.EXPECT().RescheduleOrders(gomock.Any(), numbers).Return(nil)
+				}
+			}
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/internal/accruals", bytes.NewBufferString(tt.body))
+			h.PushAccruals().ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
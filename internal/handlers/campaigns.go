@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+type promoRequest struct {
+	Code string `json:"code"`
+}
+
+func (h *Handler) CreateCampaign() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var c storage.Campaign
+		if err := json.Unmarshal(content, &c); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		statusCode, err := h.Storage.CreateCampaign(r.Context(), &c)
+		if err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusCreated, c)
+	}
+}
+
+func (h *Handler) GetCampaigns() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		statusCode, campaigns, err := h.Storage.GetCampaigns(r.Context())
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, campaigns)
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
+
+func (h *Handler) CampaignRedemptions() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Errorf("wrong campaign id").Error()))
+			return
+		}
+		statusCode, redemptions, err := h.Storage.GetCampaignRedemptions(r.Context(), id)
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, redemptions)
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
+
+// RedeemPromo погашает промокод пользователя и возвращает зачисленный бонус.
+func (h *Handler) RedeemPromo() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var req promoRequest
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, redemption, err := h.Storage.RedeemPromo(r.Context(), userSession, req.Code)
+		if err != nil {
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusOK, redemption)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_RedeemPromo(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		answer       *storage.PromoRedemption
+		statusCode   int
+		errFromDB    error
+		callStorage  bool
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			body:         `{"code":"WELCOME"}`,
+			answer:       &storage.PromoRedemption{CampaignID: 1, Code: "WELCOME", UserID: 1, Bonus: 100},
+			statusCode:   http.StatusOK,
+			callStorage:  true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 400 wrong body",
+			body:         `{"code":`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Test 404 unknown code",
+			body:         `{"code":"NOPE"}`,
+			statusCode:   http.StatusNotFound,
+			errFromDB:    errors.New("promo code NOPE not found"),
+			callStorage:  true,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409 already redeemed",
+			body:         `{"code":"WELCOME"}`,
+			statusCode:   http.StatusConflict,
+			errFromDB:    errors.New("promo code WELCOME already redeemed"),
+			callStorage:  true,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "Test 422 expired",
+			body:         `{"code":"SUMMER"}`,
+			statusCode:   http.StatusUnprocessableEntity,
+			errFromDB:    errors.New("promo code SUMMER is not active"),
+			callStorage:  true,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/user/promo", bytes.NewBufferString(tt.body))
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			if tt.callStorage {
+				s.EXPECT().RedeemPromo(gomock.Any(), "test", gomock.Any()).Return(tt.statusCode, tt.answer, tt.errFromDB)
+			}
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got storage.PromoRedemption
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, *tt.answer, got)
+			}
+		})
+	}
+}
+
+func TestHandler_Campaigns(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		mock         func(s *mocks.MockStorage)
+		expectedCode int
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/api/admin/campaigns",
+			body:   `{"code":"welcome","bonus":100,"max_redemptions":10}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CreateCampaign(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, c *storage.Campaign) (int, error) {
+					assert.Equal(t, "welcome", c.Code)
+					assert.Equal(t, 100.0, c.Bonus)
+					assert.Equal(t, 10, c.MaxRedemptions)
+					return http.StatusCreated, nil
+				})
+			},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:   "create duplicate",
+			method: http.MethodPost,
+			path:   "/api/admin/campaigns",
+			body:   `{"code":"welcome","bonus":100}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CreateCampaign(gomock.Any(), gomock.Any()).Return(http.StatusConflict, errors.New("promo code WELCOME already exists"))
+			},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:   "list",
+			method: http.MethodGet,
+			path:   "/api/admin/campaigns",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().GetCampaigns(gomock.Any()).Return(http.StatusOK, []storage.Campaign{{ID: 1, Code: "WELCOME"}}, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "redemptions",
+			method: http.MethodGet,
+			path:   "/api/admin/campaigns/1/redemptions",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().GetCampaignRedemptions(gomock.Any(), int64(1)).Return(http.StatusNoContent, nil, errors.New("no one redemption"))
+			},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "redemptions wrong id",
+			method:       http.MethodGet,
+			path:         "/api/admin/campaigns/abc/redemptions",
+			mock:         func(s *mocks.MockStorage) {},
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+				cfg:          config.ServerConfig{AdminToken: "admin"},
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Authorization", "Bearer admin")
+			tt.mock(s)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// Clawback отменяет начисление по заказу, возвращенному в магазин. В теле запроса
+// передается номер заказа {"order": "..."}.
+func (h *Handler) Clawback() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var c storage.Clawback
+		if err := json.Unmarshal(content, &c); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		statusCode, err := h.Storage.Clawback(r.Context(), storage.SourceSystem, &c)
+		if err != nil {
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusOK, c)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/webhooks"
+)
+
+func TestHandler_Clawback(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		secret       string
+		answer       storage.Clawback
+		statusCode   int
+		errFromDB    error
+		callStorage  bool
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			body:         `{"order":"12345678903"}`,
+			secret:       "internal",
+			answer:       storage.Clawback{Order: "12345678903", Amount: 500, Current: -200, Debt: 200},
+			statusCode:   http.StatusOK,
+			callStorage:  true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 409 not processed",
+			body:         `{"order":"12345678903"}`,
+			secret:       "internal",
+			statusCode:   http.StatusConflict,
+			errFromDB:    errors.New("order 12345678903 in status NEW can't be reversed"),
+			callStorage:  true,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "Test 400 wrong body",
+			body:         `{"order":`,
+			secret:       "internal",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Test 401 wrong signature",
+			body:         `{"order":"12345678903"}`,
+			secret:       "other",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+				cfg:          config.ServerConfig{InternalSecret: "internal"},
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			if tt.callStorage {
+				s.EXPECT().Clawback(gomock.Any(), storage.SourceSystem, gomock.Any()).DoAndReturn(func(ctx context.Context, source string, c *storage.Clawback) (int, error) {
+					assert.Equal(t, "12345678903", c.Order)
+					*c = tt.answer
+					return tt.statusCode, tt.errFromDB
+				})
+			}
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req, _ := http.NewRequest(http.MethodPost, "/internal/clawbacks", bytes.NewBufferString(tt.body))
+			req.Header.Set(HeaderInternalTimestamp, timestamp)
+			req.Header.Set(HeaderInternalSignature, webhooks.Sign(tt.secret, timestamp, []byte(tt.body)))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got storage.Clawback
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.answer, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// Events отдает поток событий пользователя в формате Server-Sent Events.
+// Клиент, переподключившийся с заголовком Last-Event-ID, получает пропущенные события из истории.
+func (h *Handler) Events() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		if !ok || h.hub == nil {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		userID, err := h.Storage.GetUserID(r.Context(), userSession)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		var lastEventID int64
+		if v := r.Header.Get("Last-Event-ID"); v != "" {
+			if lastEventID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(fmt.Errorf("wrong Last-Event-ID %s", v).Error()))
+				return
+			}
+		}
+
+		backlog, ch, unsubscribe := h.hub.Subscribe(userID, lastEventID)
+		defer unsubscribe()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("Connection", "keep-alive")
+		rw.WriteHeader(http.StatusOK)
+		for _, e := range backlog {
+			if err = writeEvent(rw, e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err = writeEvent(rw, e); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err = fmt.Fprint(rw, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(rw http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
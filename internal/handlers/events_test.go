@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/stream"
+)
+
+func TestHandler_Events(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockStorage(ctrl)
+	hub := stream.NewHub(10)
+	h := &Handler{
+		Storage:      s,
+		logger:       *loggers.NewLogger(),
+		sessionStore: sessions.NewCookieStore([]byte("secret")),
+		hub:          hub,
+	}
+	s.EXPECT().GetUserID(gomock.Any(), "test").Return(1, nil).AnyTimes()
+
+	//событие из истории, которое клиент пропустил
+	missed, err := events.NewEvent(events.TypeBalanceWithdrawn, "2377225624", events.BalanceWithdrawn{UserID: 1, Order: "2377225624", Sum: 10})
+	assert.NoError(t, err)
+	missed.ID = 5
+	hub.Publish(missed)
+
+	srv := httptest.NewServer(h.Auth(h.Events()))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sc := securecookie.New([]byte("secret"), nil)
+	cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+	req.Header.Set("Last-Event-ID", "4")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	assert.Contains(t, readEvent(), "id: 5\nevent: balance.withdrawn\n")
+
+	live, err := events.NewEvent(events.TypeOrderStatusChanged, "12345678903", events.OrderStatusChanged{UserID: 1, Order: "12345678903", Status: "PROCESSED"})
+	assert.NoError(t, err)
+	live.ID = 6
+	hub.Publish(live)
+	assert.Contains(t, readEvent(), "id: 6\nevent: order.status_changed\n")
+}
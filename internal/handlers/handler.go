@@ -3,17 +3,28 @@ package handlers
 import (
 	"compress/gzip"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/sessions"
-
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/stream"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
 )
 
 const (
@@ -23,6 +34,8 @@ const (
 
 type ctxKey int8
 
+var tracer = otel.Tracer("github.com/CyrilSbrodov/GopherAPIStore/internal/handlers")
+
 type Handlers interface {
 	Register(router *chi.Mux)
 }
@@ -31,29 +44,70 @@ type Handler struct {
 	storage.Storage
 	logger       loggers.Logger
 	sessionStore sessions.Store
+	cfg          config.ServerConfig
+	hub          *stream.Hub
 }
 
-func NewHandler(storage storage.Storage, logger *loggers.Logger, sessionStore sessions.Store) Handlers {
+func NewHandler(storage storage.Storage, logger *loggers.Logger, sessionStore sessions.Store, cfg config.ServerConfig, hub *stream.Hub) Handlers {
 	return &Handler{
 		storage,
 		*logger,
 		sessionStore,
+		cfg,
+		hub,
 	}
 }
 
 func (h *Handler) Register(r *chi.Mux) {
 	compressor := middleware.NewCompressor(gzip.DefaultCompression)
+	r.Use(h.Tracing)
 	r.Use(compressor.Handler)
 	r.Post("/api/user/register", h.Registration())
 	r.Post("/api/user/login", h.Login())
+	r.With(h.AccrualAuth).Post("/internal/accruals", h.PushAccruals())
+	r.With(h.InternalAuth).Post("/internal/refunds", h.RefundWithdrawal(storage.SourceSystem))
+	r.With(h.InternalAuth).Post("/internal/clawbacks", h.Clawback())
 
 	r.Group(func(r chi.Router) {
 		r.Use(h.Auth)
 		r.Post("/api/user/orders", h.Orders())
 		r.Get("/api/user/orders", h.GetOrders())
+		r.Get("/api/user/orders/{number}", h.OrderDetail())
+		r.Delete("/api/user/orders/{number}", h.CancelOrder())
 		r.Get("/api/user/balance", h.Balance())
 		r.Post("/api/user/balance/withdraw", h.Withdraw())
+		r.Post("/api/user/balance/transfer", h.Transfer())
+		r.Get("/api/user/balance/transfers", h.Transfers())
+		r.Post("/api/user/balance/holds", h.CreateHold())
+		r.Get("/api/user/balance/holds", h.GetHolds())
+		r.Post("/api/user/balance/holds/{id}/capture", h.CaptureHold())
+		r.Post("/api/user/balance/holds/{id}/release", h.ReleaseHold())
 		r.Get("/api/user/withdrawals", h.WithdrawInfo())
+		r.Get("/api/user/statement", h.Statement())
+		r.Get("/api/user/tier/history", h.TierHistory())
+		r.Post("/api/user/promo", h.RedeemPromo())
+		r.Get("/api/user/events", h.Events())
+		r.Post("/api/user/webhooks", h.CreateWebhook())
+		r.Get("/api/user/webhooks", h.GetWebhooks())
+		r.Delete("/api/user/webhooks/{id}", h.DeleteWebhook())
+		r.Get("/api/user/webhooks/{id}/deliveries", h.WebhookDeliveries())
+		r.Post("/api/user/webhooks/deliveries/{id}/replay", h.ReplayWebhookDelivery())
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.AdminAuth)
+		r.Post("/api/admin/webhooks", h.CreateWebhook())
+		r.Get("/api/admin/webhooks", h.GetWebhooks())
+		r.Delete("/api/admin/webhooks/{id}", h.DeleteWebhook())
+		r.Get("/api/admin/webhooks/{id}/deliveries", h.WebhookDeliveries())
+		r.Post("/api/admin/webhooks/deliveries/{id}/replay", h.ReplayWebhookDelivery())
+		r.Get("/api/admin/orders/failed", h.FailedOrders())
+		r.Post("/api/admin/points/expire", h.ExpirePoints())
+		r.Post("/api/admin/campaigns", h.CreateCampaign())
+		r.Get("/api/admin/campaigns", h.GetCampaigns())
+		r.Get("/api/admin/campaigns/{id}/redemptions", h.CampaignRedemptions())
+		r.Post("/api/admin/withdrawals/{order}/refund", h.RefundWithdrawal(storage.SourceAdmin))
+		r.Get("/api/admin/withdrawals/{order}/refunds", h.GetRefunds())
 	})
 }
 
@@ -82,7 +136,7 @@ func (h *Handler) Registration() http.HandlerFunc {
 			return
 		}
 
-		err = h.Storage.Register(&u)
+		err = h.Storage.Register(r.Context(), &u)
 		if err != nil {
 			h.logger.LogErr(err, "")
 			rw.WriteHeader(http.StatusConflict)
@@ -138,7 +192,7 @@ func (h *Handler) Login() http.HandlerFunc {
 			return
 		}
 
-		err = h.Storage.Login(&u)
+		err = h.Storage.Login(r.Context(), &u)
 		if err != nil {
 			h.logger.LogErr(err, "wrong password or login")
 			rw.WriteHeader(http.StatusUnauthorized)
@@ -181,7 +235,8 @@ func (h *Handler) Orders() http.HandlerFunc {
 		defer r.Body.Close()
 
 		userSession := r.Context().Value(ctxKeyUser).(string)
-		statusCode, err := h.CollectOrder(userSession, string(content))
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String(tracing.AttrOrderNumber, string(content)))
+		statusCode, err := h.CollectOrder(r.Context(), userSession, string(content))
 		switch statusCode {
 		case http.StatusOK:
 			rw.Header().Set("Content-Type", "application/json")
@@ -220,7 +275,7 @@ func (h *Handler) GetOrders() http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 
 		userSession := r.Context().Value(ctxKeyUser).(string)
-		statusCode, orders, err := h.GetOrder(userSession)
+		statusCode, orders, err := h.GetOrder(r.Context(), userSession)
 		switch statusCode {
 		case http.StatusOK:
 			ordersJSON, err := json.Marshal(orders)
@@ -253,7 +308,7 @@ func (h *Handler) Balance() http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 
 		userSession := r.Context().Value(ctxKeyUser).(string)
-		balance, err := h.GetBalance(userSession)
+		balance, err := h.GetBalance(r.Context(), userSession)
 		if err != nil {
 			h.logger.LogErr(err, "")
 			rw.Header().Set("Content-Type", "application/json")
@@ -292,7 +347,8 @@ func (h *Handler) Withdraw() http.HandlerFunc {
 			return
 		}
 		userSession := r.Context().Value(ctxKeyUser).(string)
-		statusCode, err := h.Storage.Withdraw(userSession, &o)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String(tracing.AttrOrderNumber, o.Order))
+		statusCode, err := h.Storage.Withdraw(r.Context(), userSession, &o)
 		switch statusCode {
 		case http.StatusOK:
 			rw.Header().Set("Content-Type", "application/json")
@@ -309,6 +365,10 @@ func (h *Handler) Withdraw() http.HandlerFunc {
 			rw.Write([]byte(err.Error()))
 			return
 		case http.StatusUnprocessableEntity:
+			//нарушение правил списания возвращается структурой с названием правила и лимитом
+			if h.writePolicyViolation(rw, err) {
+				return
+			}
 			rw.Header().Set("Content-Type", "application/json")
 			rw.WriteHeader(http.StatusUnprocessableEntity)
 			rw.Write([]byte(err.Error()))
@@ -320,7 +380,7 @@ func (h *Handler) Withdraw() http.HandlerFunc {
 func (h *Handler) WithdrawInfo() http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		userSession := r.Context().Value(ctxKeyUser).(string)
-		statusCode, withdrawals, err := h.Withdrawals(userSession)
+		statusCode, withdrawals, err := h.Withdrawals(r.Context(), userSession)
 		switch statusCode {
 		case http.StatusOK:
 			result, err := json.Marshal(withdrawals)
@@ -365,7 +425,52 @@ func (h *Handler) Auth(next http.Handler) http.Handler {
 			rw.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		if login, ok := userSession.(string); ok {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String(tracing.AttrUserLogin, login))
+		}
 
 		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, userSession)))
 	})
 }
+
+// AdminAuth пропускает запросы с заголовком Authorization: Bearer <ADMIN_TOKEN>.
+// Если токен администратора не задан, административные методы недоступны.
+// В контекст запроса кладется пустой логин, что для хранилища означает действие администратора.
+func (h *Handler) AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if h.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AdminToken)) != 1 {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, "")))
+	})
+}
+
+func (h *Handler) Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		//извлечение контекста трассировки из заголовков запроса
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(rw, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		//после роутинга известен шаблон маршрута, по нему и называем спан
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRouteKey.String(rctx.RoutePattern()))
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(ww.Status()))
+		if ww.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(ww.Status()))
+		}
+	})
+}
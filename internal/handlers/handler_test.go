@@ -15,7 +15,12 @@ import (
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
@@ -74,7 +79,7 @@ func TestHandler_Registration(t *testing.T) {
 
 			rec := httptest.NewRecorder()
 			req, _ := http.NewRequest(http.MethodPost, "/api/user/register", bytes.NewBuffer(bodyJSON))
-			s.EXPECT().Register(gomock.Any()).Return(tt.answer).AnyTimes()
+			s.EXPECT().Register(gomock.Any(), gomock.Any()).Return(tt.answer).AnyTimes()
 			h.Registration().ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -183,7 +188,7 @@ func TestHandler_Balance(t *testing.T) {
 				sessionStore: sessions.NewCookieStore([]byte("secret")),
 			}
 
-			s.EXPECT().GetBalance(gomock.Any()).Return(tt.answerFromDB, tt.errFromDB).AnyTimes()
+			s.EXPECT().GetBalance(gomock.Any(), gomock.Any()).Return(tt.answerFromDB, tt.errFromDB).AnyTimes()
 			h.Auth(h.Balance()).ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -267,7 +272,7 @@ func TestHandler_GetOrders(t *testing.T) {
 				sessionStore: sessions.NewCookieStore([]byte("secret")),
 			}
 
-			s.EXPECT().GetOrder(gomock.Any()).Return(tt.statusCode, tt.answerFromDB, tt.errFromDB).AnyTimes()
+			s.EXPECT().GetOrder(gomock.Any(), gomock.Any()).Return(tt.statusCode, tt.answerFromDB, tt.errFromDB).AnyTimes()
 			h.Auth(h.GetOrders()).ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -326,7 +331,7 @@ func TestHandler_Login(t *testing.T) {
 				sessionStore: sessions.NewCookieStore([]byte("secret")),
 			}
 
-			s.EXPECT().Login(gomock.Any()).Return(tt.errFromDB).AnyTimes()
+			s.EXPECT().Login(gomock.Any(), gomock.Any()).Return(tt.errFromDB).AnyTimes()
 			h.Login().ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -430,7 +435,7 @@ func TestHandler_Orders(t *testing.T) {
 				sessionStore: sessions.NewCookieStore([]byte("secret")),
 			}
 
-			s.EXPECT().CollectOrder(gomock.Any(), gomock.Any()).Return(tt.statusCode, tt.errFromDB).AnyTimes()
+			s.EXPECT().CollectOrder(gomock.Any(), gomock.Any(), gomock.Any()).Return(tt.statusCode, tt.errFromDB).AnyTimes()
 			h.Auth(h.Orders()).ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -531,7 +536,7 @@ func TestHandler_Withdraw(t *testing.T) {
 				sessionStore: sessions.NewCookieStore([]byte("secret")),
 			}
 
-			s.EXPECT().Withdraw(gomock.Any(), gomock.Any()).Return(tt.statusCode, tt.errFromDB).AnyTimes()
+			s.EXPECT().Withdraw(gomock.Any(), gomock.Any(), gomock.Any()).Return(tt.statusCode, tt.errFromDB).AnyTimes()
 			h.Auth(h.Withdraw()).ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -611,7 +616,7 @@ func TestHandler_WithdrawInfo(t *testing.T) {
 				sessionStore: sessions.NewCookieStore([]byte("secret")),
 			}
 
-			s.EXPECT().Withdrawals(gomock.Any()).Return(tt.statusCode, tt.answer, tt.errFromDB).AnyTimes()
+			s.EXPECT().Withdrawals(gomock.Any(), gomock.Any()).Return(tt.statusCode, tt.answer, tt.errFromDB).AnyTimes()
 			h.Auth(h.WithdrawInfo()).ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -674,6 +679,7 @@ func TestNewHandler(t *testing.T) {
 		storage      storage.Storage
 		logger       *loggers.Logger
 		sessionStore sessions.Store
+		cfg          config.ServerConfig
 	}
 	tests := []struct {
 		name string
@@ -687,12 +693,40 @@ func TestNewHandler(t *testing.T) {
 				logger:       logger,
 				sessionStore: sessionStore,
 			},
-			want: NewHandler(s, logger, sessionStore),
+			want: NewHandler(s, logger, sessionStore, config.ServerConfig{}, nil),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.want, NewHandler(tt.args.storage, tt.args.logger, tt.args.sessionStore), "NewHandler(%v, %v, %v)", tt.args.storage, tt.args.logger, tt.args.sessionStore)
+			assert.Equalf(t, tt.want, NewHandler(tt.args.storage, tt.args.logger, tt.args.sessionStore, tt.args.cfg, nil), "NewHandler(%v, %v, %v, %v)", tt.args.storage, tt.args.logger, tt.args.sessionStore, tt.args.cfg)
 		})
 	}
 }
+
+func TestHandler_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockStorage(ctrl)
+	logger := loggers.NewLogger()
+	h := &Handler{
+		Storage:      s,
+		logger:       *logger,
+		sessionStore: sessions.NewCookieStore([]byte("secret")),
+	}
+	router := chi.NewRouter()
+	h.Register(router)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/balance", nil)
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "GET /api/user/balance", spans[0].Name())
+		assert.Contains(t, spans[0].Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusUnauthorized))
+	}
+}
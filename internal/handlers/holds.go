@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// CreateHold резервирует баллы под заказ {"order": "...", "sum": ...} до его оплаты.
+func (h *Handler) CreateHold() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var hold storage.Hold
+		if err := json.Unmarshal(content, &hold); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, err := h.Storage.CreateHold(r.Context(), userSession, &hold)
+		if err != nil {
+			if statusCode == http.StatusUnprocessableEntity && h.writePolicyViolation(rw, err) {
+				return
+			}
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusCreated, hold)
+	}
+}
+
+func (h *Handler) GetHolds() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, holds, err := h.Storage.GetHolds(r.Context(), userSession)
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, holds)
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			h.logger.LogErr(err, "")
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
+
+// CaptureHold подтверждает удержание и списывает зарезервированные баллы.
+func (h *Handler) CaptureHold() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Errorf("wrong hold id").Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, hold, err := h.Storage.CaptureHold(r.Context(), userSession, id)
+		if err != nil {
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusOK, hold)
+	}
+}
+
+// ReleaseHold снимает удержание без списания.
+func (h *Handler) ReleaseHold() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Errorf("wrong hold id").Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, err := h.Storage.ReleaseHold(r.Context(), userSession, id)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(statusCode)
+		if err != nil {
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_Holds(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		mock         func(s *mocks.MockStorage)
+		expectedCode int
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/api/user/balance/holds",
+			body:   `{"order":"2377225624","sum":100}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CreateHold(gomock.Any(), "test", gomock.Any()).DoAndReturn(func(ctx context.Context, login string, h *storage.Hold) (int, error) {
+					assert.Equal(t, "2377225624", h.Order)
+					assert.Equal(t, 100.0, h.Sum)
+					return http.StatusCreated, nil
+				})
+			},
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "create wrong body",
+			method:       http.MethodPost,
+			path:         "/api/user/balance/holds",
+			body:         `{"order":`,
+			mock:         func(s *mocks.MockStorage) {},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:   "create insufficient funds",
+			method: http.MethodPost,
+			path:   "/api/user/balance/holds",
+			body:   `{"order":"2377225624","sum":100}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CreateHold(gomock.Any(), "test", gomock.Any()).Return(http.StatusPaymentRequired, errors.New("insufficient funds"))
+			},
+			expectedCode: http.StatusPaymentRequired,
+		},
+		{
+			name:   "list",
+			method: http.MethodGet,
+			path:   "/api/user/balance/holds",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().GetHolds(gomock.Any(), "test").Return(http.StatusOK, []storage.Hold{{ID: 1, Order: "2377225624", Sum: 100}}, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "capture",
+			method: http.MethodPost,
+			path:   "/api/user/balance/holds/1/capture",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CaptureHold(gomock.Any(), "test", int64(1)).Return(http.StatusOK, &storage.Hold{ID: 1, Status: "CAPTURED"}, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "capture expired",
+			method: http.MethodPost,
+			path:   "/api/user/balance/holds/1/capture",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CaptureHold(gomock.Any(), "test", int64(1)).Return(http.StatusConflict, nil, errors.New("hold 1 is EXPIRED"))
+			},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:   "release",
+			method: http.MethodPost,
+			path:   "/api/user/balance/holds/1/release",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().ReleaseHold(gomock.Any(), "test", int64(1)).Return(http.StatusOK, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "release wrong id",
+			method:       http.MethodPost,
+			path:         "/api/user/balance/holds/abc/release",
+			mock:         func(s *mocks.MockStorage) {},
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			tt.mock(s)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
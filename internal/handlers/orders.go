@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// OrderDetail отдает заказ пользователя вместе с историей смены статусов и списаниями.
+// Ответ снабжается ETag, и клиент, опрашивающий заказ с If-None-Match, получает 304,
+// пока заказ не изменился.
+func (h *Handler) OrderDetail() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		number := chi.URLParam(r, "number")
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String(tracing.AttrOrderNumber, number))
+		statusCode, order, err := h.Storage.GetOrderDetail(r.Context(), userSession, number)
+		switch statusCode {
+		case http.StatusOK:
+			orderJSON, err := json.Marshal(order)
+			if err != nil {
+				h.logger.LogErr(err, "failed to marshal")
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			sum := sha256.Sum256(orderJSON)
+			//тег слабый: тело может отдаваться сжатым, а представление от этого не меняется
+			etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+			rw.Header().Set("ETag", etag)
+			rw.Header().Set("Cache-Control", "private, no-cache")
+			if etagMatch(r.Header.Get("If-None-Match"), etag) {
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusOK)
+			rw.Write(orderJSON)
+			return
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+}
+
+// CancelOrder отменяет заказ, загруженный по ошибке, пока система начислений его не видела.
+func (h *Handler) CancelOrder() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		number := chi.URLParam(r, "number")
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String(tracing.AttrOrderNumber, number))
+		statusCode, err := h.Storage.CancelOrder(r.Context(), userSession, number)
+		switch statusCode {
+		case http.StatusOK:
+			rw.WriteHeader(http.StatusOK)
+			return
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+}
+
+// etagMatch проверяет заголовок If-None-Match: список тегов через запятую или "*".
+// Теги сравниваются без префикса W/, как того требует слабое сравнение.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// FailedOrders отдает поддержке заказы, которые система начислений так и не рассчитала.
+func (h *Handler) FailedOrders() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		statusCode, orders, err := h.Storage.GetFailedOrders(r.Context())
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, orders)
+			return
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+}
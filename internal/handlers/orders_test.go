@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_FailedOrders(t *testing.T) {
+	checkedAt := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		answer       []storage.Orders
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name: "Test 200",
+			answer: []storage.Orders{
+				{UserID: 1, Order: "12345678903", Status: "FAILED", Attempts: 12, LastCheckedAt: &checkedAt, UploadedAt: checkedAt.Add(-72 * time.Hour)},
+			},
+			statusCode:   http.StatusOK,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 204",
+			statusCode:   http.StatusNoContent,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Test 500",
+			statusCode:   http.StatusInternalServerError,
+			errFromDB:    errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/admin/orders/failed", nil)
+			req.Header.Set("Authorization", "Bearer admin")
+			h := &Handler{
+				Storage: s,
+				logger:  *loggers.NewLogger(),
+				cfg:     config.ServerConfig{AdminToken: "admin"},
+			}
+
+			s.EXPECT().GetFailedOrders(gomock.Any()).Return(tt.statusCode, tt.answer, tt.errFromDB)
+			h.AdminAuth(h.FailedOrders()).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got []storage.Orders
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.answer, got)
+			}
+		})
+	}
+}
+
+func TestHandler_OrderDetail(t *testing.T) {
+	uploadedAt := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	detail := &storage.OrderDetail{
+		Orders: storage.Orders{Order: "12345678903", Status: "PROCESSED", Accrual: 500, UploadedAt: uploadedAt},
+		History: []storage.OrderStatusChange{
+			{Status: "NEW", Source: storage.SourceUser, CreatedAt: uploadedAt},
+			{OldStatus: "NEW", Status: "PROCESSING", Source: storage.SourceAgent, CreatedAt: uploadedAt.Add(time.Minute)},
+			{OldStatus: "PROCESSING", Status: "PROCESSED", Accrual: 500, Source: storage.SourcePush, CreatedAt: uploadedAt.Add(2 * time.Minute)},
+		},
+		Withdrawals: []storage.Order{{Order: "12345678903", Sum: 100, ProcessedAt: uploadedAt.Add(time.Hour)}},
+	}
+	tests := []struct {
+		name         string
+		answer       *storage.OrderDetail
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			answer:       detail,
+			statusCode:   http.StatusOK,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 403",
+			statusCode:   http.StatusForbidden,
+			errFromDB:    errors.New("order 12345678903 belongs to another user"),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Test 404",
+			statusCode:   http.StatusNotFound,
+			errFromDB:    errors.New("order 12345678903 not found"),
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			sc := securecookie.New([]byte("secret"), nil)
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/user/orders/12345678903", nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			s.EXPECT().GetOrderDetail(gomock.Any(), "test", "12345678903").Return(tt.statusCode, tt.answer, tt.errFromDB)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got storage.OrderDetail
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, *tt.answer, got)
+			}
+		})
+	}
+}
+
+func TestHandler_OrderDetailETag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockStorage(ctrl)
+	h := &Handler{
+		Storage:      s,
+		logger:       *loggers.NewLogger(),
+		sessionStore: sessions.NewCookieStore([]byte("secret")),
+	}
+	router := chi.NewRouter()
+	h.Register(router)
+	sc := securecookie.New([]byte("secret"), nil)
+	cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+
+	detail := &storage.OrderDetail{Orders: storage.Orders{Order: "12345678903", Status: "PROCESSING"}}
+	s.EXPECT().GetOrderDetail(gomock.Any(), "test", "12345678903").Return(http.StatusOK, detail, nil).Times(3)
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/user/orders/12345678903", nil)
+		req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	//заказ не изменился — тело не передается
+	second := get(etag)
+	assert.Equal(t, http.StatusNotModified, second.Code)
+	assert.Empty(t, second.Body.String())
+
+	//после смены статуса тег другой, и клиент получает новое тело
+	detail.Status = "PROCESSED"
+	third := get(etag)
+	assert.Equal(t, http.StatusOK, third.Code)
+	assert.NotEqual(t, etag, third.Header().Get("ETag"))
+}
+
+func Test_etagMatch(t *testing.T) {
+	assert.True(t, etagMatch(`W/"abc"`, `W/"abc"`))
+	assert.True(t, etagMatch(`"abc"`, `W/"abc"`))
+	assert.True(t, etagMatch(`"x", W/"abc"`, `W/"abc"`))
+	assert.True(t, etagMatch(`*`, `W/"abc"`))
+	assert.False(t, etagMatch(``, `W/"abc"`))
+	assert.False(t, etagMatch(`"abd"`, `W/"abc"`))
+}
+
+func TestHandler_CancelOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			statusCode:   http.StatusOK,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 403",
+			statusCode:   http.StatusForbidden,
+			errFromDB:    errors.New("order 12345678903 belongs to another user"),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Test 404",
+			statusCode:   http.StatusNotFound,
+			errFromDB:    errors.New("order 12345678903 not found"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			statusCode:   http.StatusConflict,
+			errFromDB:    errors.New("order 12345678903 is already being processed"),
+			expectedCode: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			sc := securecookie.New([]byte("secret"), nil)
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodDelete, "/api/user/orders/12345678903", nil)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			s.EXPECT().CancelOrder(gomock.Any(), "test", "12345678903").Return(tt.statusCode, tt.errFromDB)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
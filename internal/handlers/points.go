@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ExpirePoints запускает сгорание баллов вручную. С параметром dry_run=true баллы
+// не списываются, а в ответе приходит отчет о том, что сгорело бы.
+func (h *Handler) ExpirePoints() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		dryRun := false
+		if v := r.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+		}
+		report, err := h.Storage.ExpirePoints(r.Context(), dryRun)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if len(report) == 0 {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.writeJSON(rw, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_ExpirePoints(t *testing.T) {
+	report := []storage.PointsExpiry{{UserID: 1, Amount: 250, Lots: 2}}
+	tests := []struct {
+		name         string
+		query        string
+		dryRun       bool
+		answer       []storage.PointsExpiry
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "dry run",
+			query:        "?dry_run=true",
+			dryRun:       true,
+			answer:       report,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "expire",
+			answer:       report,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "nothing to expire",
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "wrong dry_run",
+			query:        "?dry_run=maybe",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "storage error",
+			errFromDB:    errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage: s,
+				logger:  *loggers.NewLogger(),
+				cfg:     config.ServerConfig{AdminToken: "admin"},
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			if tt.expectedCode != http.StatusBadRequest {
+				s.EXPECT().ExpirePoints(gomock.Any(), tt.dryRun).Return(tt.answer, tt.errFromDB)
+			}
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/admin/points/expire"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer admin")
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got []storage.PointsExpiry
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.answer, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/policy"
+)
+
+// writePolicyViolation отвечает 422 с описанием нарушенного правила списания, если err —
+// *policy.Violation, и сообщает, был ли записан ответ.
+func (h *Handler) writePolicyViolation(rw http.ResponseWriter, err error) bool {
+	var v *policy.Violation
+	if !errors.As(err, &v) {
+		return false
+	}
+	h.writeJSON(rw, http.StatusUnprocessableEntity, v)
+	return true
+}
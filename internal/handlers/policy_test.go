@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/policy"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_WithdrawPolicy(t *testing.T) {
+	violation := &policy.Violation{Rule: policy.RuleMaxOrderShare, Limit: 50, Actual: 80,
+		Message: "points can pay at most 50% of the order"}
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		mock         func(s *mocks.MockStorage)
+		expectedCode int
+		expectedRule string
+	}{
+		{
+			name: "withdraw violation",
+			path: "/api/user/balance/withdraw",
+			body: `{"order":"2377225624","sum":400,"order_total":500}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().Withdraw(gomock.Any(), "test", gomock.Any()).DoAndReturn(func(ctx context.Context, login string, o *storage.Order) (int, error) {
+					assert.Equal(t, 500.0, o.Total)
+					return http.StatusUnprocessableEntity, violation
+				})
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedRule: policy.RuleMaxOrderShare,
+		},
+		{
+			name: "withdraw wrong order",
+			path: "/api/user/balance/withdraw",
+			body: `{"order":"23","sum":400}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().Withdraw(gomock.Any(), "test", gomock.Any()).Return(http.StatusUnprocessableEntity, errors.New("wrong orders number 23"))
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "hold violation",
+			path: "/api/user/balance/holds",
+			body: `{"order":"2377225624","sum":400,"order_total":500}`,
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().CreateHold(gomock.Any(), "test", gomock.Any()).DoAndReturn(func(ctx context.Context, login string, h *storage.Hold) (int, error) {
+					assert.Equal(t, 500.0, h.Total)
+					return http.StatusUnprocessableEntity, violation
+				})
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedRule: policy.RuleMaxOrderShare,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			tt.mock(s)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedRule == "" {
+				return
+			}
+			var v policy.Violation
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v))
+			assert.Equal(t, tt.expectedRule, v.Rule)
+			assert.Equal(t, 50.0, v.Limit)
+			assert.Equal(t, 80.0, v.Actual)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+const (
+	HeaderInternalTimestamp = "X-Internal-Timestamp"
+	HeaderInternalSignature = "X-Internal-Signature"
+)
+
+// InternalAuth проверяет подпись запросов внутренних систем магазина так же, как AccrualAuth,
+// но со своим секретом. Если секрет не задан, внутренний API отключен.
+func (h *Handler) InternalAuth(next http.Handler) http.Handler {
+	return signedAuth(h.cfg.InternalSecret, HeaderInternalTimestamp, HeaderInternalSignature, next)
+}
+
+// RefundWithdrawal оформляет возврат баллов по списанию. Номер списания берется из пути,
+// а если его там нет — из тела запроса.
+func (h *Handler) RefundWithdrawal(source string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var refund storage.Refund
+		if len(content) > 0 {
+			if err := json.Unmarshal(content, &refund); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+		}
+		if order := chi.URLParam(r, "order"); order != "" {
+			refund.Order = order
+		}
+		statusCode, err := h.Storage.RefundWithdrawal(r.Context(), source, &refund)
+		if err != nil {
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusCreated, refund)
+	}
+}
+
+func (h *Handler) GetRefunds() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		statusCode, refunds, err := h.Storage.GetRefunds(r.Context(), chi.URLParam(r, "order"))
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, refunds)
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
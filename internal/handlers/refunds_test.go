@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/webhooks"
+)
+
+func TestHandler_RefundWithdrawal(t *testing.T) {
+	tests := []struct {
+		name         string
+		request      func() *http.Request
+		source       string
+		order        string
+		sum          float64
+		statusCode   int
+		errFromDB    error
+		callStorage  bool
+		expectedCode int
+	}{
+		{
+			name: "admin partial refund",
+			request: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, "/api/admin/withdrawals/2377225624/refund",
+					bytes.NewBufferString(`{"sum":50,"reason":"order cancelled"}`))
+				req.Header.Set("Authorization", "Bearer admin")
+				return req
+			},
+			source:       storage.SourceAdmin,
+			order:        "2377225624",
+			sum:          50,
+			statusCode:   http.StatusCreated,
+			callStorage:  true,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name: "admin full refund without body",
+			request: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, "/api/admin/withdrawals/2377225624/refund", http.NoBody)
+				req.Header.Set("Authorization", "Bearer admin")
+				return req
+			},
+			source:       storage.SourceAdmin,
+			order:        "2377225624",
+			statusCode:   http.StatusCreated,
+			callStorage:  true,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name: "refund exceeds withdrawal",
+			request: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, "/api/admin/withdrawals/2377225624/refund",
+					bytes.NewBufferString(`{"sum":5000}`))
+				req.Header.Set("Authorization", "Bearer admin")
+				return req
+			},
+			source:       storage.SourceAdmin,
+			order:        "2377225624",
+			sum:          5000,
+			statusCode:   http.StatusConflict,
+			errFromDB:    errors.New("refund exceeds withdrawn sum"),
+			callStorage:  true,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name: "internal signed refund",
+			request: func() *http.Request {
+				body := `{"order":"2377225624","sum":20}`
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				req, _ := http.NewRequest(http.MethodPost, "/internal/refunds", bytes.NewBufferString(body))
+				req.Header.Set(HeaderInternalTimestamp, timestamp)
+				req.Header.Set(HeaderInternalSignature, webhooks.Sign("internal", timestamp, []byte(body)))
+				return req
+			},
+			source:       storage.SourceSystem,
+			order:        "2377225624",
+			sum:          20,
+			statusCode:   http.StatusCreated,
+			callStorage:  true,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name: "internal wrong signature",
+			request: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, "/internal/refunds", bytes.NewBufferString(`{"order":"2377225624"}`))
+				req.Header.Set(HeaderInternalTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+				req.Header.Set(HeaderInternalSignature, "wrong")
+				return req
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+				cfg:          config.ServerConfig{AdminToken: "admin", InternalSecret: "internal"},
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			if tt.callStorage {
+				s.EXPECT().RefundWithdrawal(gomock.Any(), tt.source, gomock.Any()).DoAndReturn(func(ctx context.Context, source string, r *storage.Refund) (int, error) {
+					assert.Equal(t, tt.order, r.Order)
+					assert.Equal(t, tt.sum, r.Sum)
+					return tt.statusCode, tt.errFromDB
+				})
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, tt.request())
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
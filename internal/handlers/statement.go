@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/statement"
+)
+
+const statementDateLayout = "2006-01-02"
+
+// Statement отдает выписку за период from–to в формате json, csv или pdf. Даты принимаются
+// в виде 2006-01-02 (to включается целиком) или RFC3339; по умолчанию — текущий месяц.
+func (h *Handler) Statement() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		now := time.Now()
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		to := from.AddDate(0, 1, 0)
+		var err error
+		if v := r.URL.Query().Get("from"); v != "" {
+			if from, err = parseStatementDate(v, false); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+		}
+		if v := r.URL.Query().Get("to"); v != "" {
+			if to, err = parseStatementDate(v, true); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+		}
+		format := r.URL.Query().Get("format")
+		sw, err := statement.NewWriter(format, rw, statement.Header{Login: userSession, From: from, To: to})
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", sw.ContentType())
+		if format == statement.FormatCSV || format == statement.FormatPDF {
+			rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement_%s_%s.%s"`,
+				from.Format(statementDateLayout), to.Format(statementDateLayout), format))
+		}
+		statusCode, err := h.Storage.Statement(r.Context(), userSession, from, to, sw)
+		if err == nil {
+			err = sw.End()
+		}
+		if err != nil {
+			//после начала записи код ответа уже отправлен, выписка обрывается
+			if sw.Started() {
+				h.logger.LogErr(err, "statement is interrupted")
+				return
+			}
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Header().Del("Content-Disposition")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
+
+// parseStatementDate разбирает границу периода; дата без времени как конец периода
+// означает начало следующего дня.
+func parseStatementDate(v string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(statementDateLayout, v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("wrong date %s", v)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_Statement(t *testing.T) {
+	writeStatement := func(ctx context.Context, login string, from, to time.Time, w storage.StatementWriter) (int, error) {
+		if err := w.Begin(100); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		err := w.Entry(storage.StatementEntry{Date: from, Kind: storage.LedgerAccrual, Reference: "12345678903", Amount: 50})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+	tests := []struct {
+		name         string
+		query        string
+		mock         func(s *mocks.MockStorage)
+		expectedCode int
+		contentType  string
+		disposition  string
+	}{
+		{
+			name:  "json by default",
+			query: "from=2026-09-01&to=2026-09-30",
+			mock: func(s *mocks.MockStorage) {
+				from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+				to := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+				s.EXPECT().Statement(gomock.Any(), "test", from, to, gomock.Any()).DoAndReturn(writeStatement)
+			},
+			expectedCode: http.StatusOK,
+			contentType:  "application/json",
+		},
+		{
+			name:  "csv",
+			query: "from=2026-09-01T00:00:00Z&to=2026-10-01T00:00:00Z&format=csv",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().Statement(gomock.Any(), "test", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(writeStatement)
+			},
+			expectedCode: http.StatusOK,
+			contentType:  "text/csv",
+			disposition:  `attachment; filename="statement_2026-09-01_2026-10-01.csv"`,
+		},
+		{
+			name:  "pdf",
+			query: "format=pdf",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().Statement(gomock.Any(), "test", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(writeStatement)
+			},
+			expectedCode: http.StatusOK,
+			contentType:  "application/pdf",
+		},
+		{
+			name:         "wrong format",
+			query:        "format=xml",
+			mock:         func(s *mocks.MockStorage) {},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "wrong date",
+			query:        "from=yesterday",
+			mock:         func(s *mocks.MockStorage) {},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:  "empty period",
+			query: "from=2026-10-01&to=2026-09-01",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().Statement(gomock.Any(), "test", gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(http.StatusBadRequest, errors.New("statement period is empty"))
+			},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:  "db error",
+			query: "format=csv",
+			mock: func(s *mocks.MockStorage) {
+				s.EXPECT().Statement(gomock.Any(), "test", gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(http.StatusInternalServerError, errors.New("err"))
+			},
+			expectedCode: http.StatusInternalServerError,
+			contentType:  "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			tt.mock(s)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/user/statement?"+tt.query, http.NoBody)
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+			}
+			if tt.disposition != "" {
+				assert.Equal(t, tt.disposition, rec.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import "net/http"
+
+// TierHistory возвращает историю смены уровня лояльности пользователя.
+func (h *Handler) TierHistory() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, history, err := h.GetTierHistory(r.Context(), userSession)
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, history)
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			h.logger.LogErr(err, "")
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_TierHistory(t *testing.T) {
+	history := []storage.TierChange{
+		{OldTier: "BASE", Tier: "SILVER", RollingPoints: 1200, CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	tests := []struct {
+		name         string
+		answer       []storage.TierChange
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			answer:       history,
+			statusCode:   http.StatusOK,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 204",
+			statusCode:   http.StatusNoContent,
+			errFromDB:    errors.New("no tier changes"),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Test 500",
+			statusCode:   http.StatusInternalServerError,
+			errFromDB:    errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/user/tier/history", nil)
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			s.EXPECT().GetTierHistory(gomock.Any(), "test").Return(tt.statusCode, tt.answer, tt.errFromDB)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got []storage.TierChange
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.answer, got)
+			}
+		})
+	}
+}
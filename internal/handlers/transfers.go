@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// Transfer переводит баллы текущего пользователя другому пользователю.
+func (h *Handler) Transfer() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var t storage.Transfer
+		if err := json.Unmarshal(content, &t); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, err := h.Storage.Transfer(r.Context(), userSession, &t)
+		if err != nil {
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "")
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		h.writeJSON(rw, http.StatusOK, t)
+	}
+}
+
+func (h *Handler) Transfers() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, transfers, err := h.Storage.Transfers(r.Context(), userSession)
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, transfers)
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			h.logger.LogErr(err, "")
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_Transfer(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		statusCode   int
+		errFromDB    error
+		callStorage  bool
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			body:         `{"to":"family","amount":150}`,
+			statusCode:   http.StatusOK,
+			callStorage:  true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 400 wrong body",
+			body:         `{"to":`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Test 402 insufficient funds",
+			body:         `{"to":"family","amount":150}`,
+			statusCode:   http.StatusPaymentRequired,
+			errFromDB:    errors.New("insufficient funds"),
+			callStorage:  true,
+			expectedCode: http.StatusPaymentRequired,
+		},
+		{
+			name:         "Test 404 unknown recipient",
+			body:         `{"to":"nobody","amount":150}`,
+			statusCode:   http.StatusNotFound,
+			errFromDB:    errors.New("recipient nobody not found"),
+			callStorage:  true,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 422 daily limit",
+			body:         `{"to":"family","amount":150}`,
+			statusCode:   http.StatusUnprocessableEntity,
+			errFromDB:    errors.New("daily transfer limit exceeded"),
+			callStorage:  true,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/user/balance/transfer", bytes.NewBufferString(tt.body))
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			if tt.callStorage {
+				s.EXPECT().Transfer(gomock.Any(), "test", gomock.Any()).DoAndReturn(func(ctx context.Context, login string, tr *storage.Transfer) (int, error) {
+					assert.Equal(t, 150.0, tr.Amount)
+					return tt.statusCode, tt.errFromDB
+				})
+			}
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestHandler_Transfers(t *testing.T) {
+	transfers := []storage.Transfer{
+		{ID: 2, From: "family", To: "test", Amount: 50, Direction: storage.TransferIn},
+		{ID: 1, From: "test", To: "family", Amount: 150, Direction: storage.TransferOut},
+	}
+	tests := []struct {
+		name         string
+		answer       []storage.Transfer
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "Test 200",
+			answer:       transfers,
+			statusCode:   http.StatusOK,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 204",
+			statusCode:   http.StatusNoContent,
+			errFromDB:    errors.New("no one transfer"),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Test 500",
+			statusCode:   http.StatusInternalServerError,
+			errFromDB:    errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/user/balance/transfers", nil)
+			cookieStr, _ := sc.Encode(sessionName, map[interface{}]interface{}{"user_id": "test"})
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			s.EXPECT().Transfers(gomock.Any(), "test").Return(tt.statusCode, tt.answer, tt.errFromDB)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got []storage.Transfer
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.answer, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func (h *Handler) CreateWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		var w storage.WebhookSubscription
+		if err := json.Unmarshal(content, &w); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, err := h.Storage.CreateWebhook(r.Context(), userSession, &w)
+		if err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		//секрет возвращается только при создании подписки
+		h.writeJSON(rw, http.StatusCreated, w)
+	}
+}
+
+func (h *Handler) GetWebhooks() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, webhooks, err := h.Storage.GetWebhooks(r.Context(), userSession)
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, webhooks)
+			return
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+}
+
+func (h *Handler) DeleteWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Errorf("wrong webhook id").Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, err := h.Storage.DeleteWebhook(r.Context(), userSession, id)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(statusCode)
+		if err != nil {
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
+
+func (h *Handler) WebhookDeliveries() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Errorf("wrong webhook id").Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, deliveries, err := h.Storage.GetWebhookDeliveries(r.Context(), userSession, id)
+		switch statusCode {
+		case http.StatusOK:
+			h.writeJSON(rw, http.StatusOK, deliveries)
+			return
+		case http.StatusNoContent:
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+	}
+}
+
+func (h *Handler) ReplayWebhookDelivery() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Errorf("wrong delivery id").Error()))
+			return
+		}
+		userSession := r.Context().Value(ctxKeyUser).(string)
+		statusCode, err := h.Storage.ReplayWebhookDelivery(r.Context(), userSession, id)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(statusCode)
+		if err != nil {
+			rw.Write([]byte(err.Error()))
+		}
+	}
+}
+
+func (h *Handler) writeJSON(rw http.ResponseWriter, statusCode int, v interface{}) {
+	result, err := json.Marshal(v)
+	if err != nil {
+		h.logger.LogErr(err, "failed to marshal")
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+	rw.Write(result)
+}
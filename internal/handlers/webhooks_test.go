@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestHandler_CreateWebhook(t *testing.T) {
+	tests := []struct {
+		name         string
+		cookieValue  map[interface{}]interface{}
+		body         string
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name: "Test 201",
+			cookieValue: map[interface{}]interface{}{
+				"user_id": "test",
+			},
+			body:         `{"url":"https://example.com/hook","event_types":["order.processed"]}`,
+			statusCode:   http.StatusCreated,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name: "Test 400 wrong body",
+			cookieValue: map[interface{}]interface{}{
+				"user_id": "test",
+			},
+			body:         `{"url":`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name: "Test 400 from storage",
+			cookieValue: map[interface{}]interface{}{
+				"user_id": "test",
+			},
+			body:         `{"url":"ftp://example.com","event_types":["order.processed"]}`,
+			statusCode:   http.StatusBadRequest,
+			errFromDB:    errors.New("wrong webhook url"),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Test 401",
+			cookieValue:  nil,
+			body:         `{}`,
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := securecookie.New([]byte("secret"), nil)
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			logger := loggers.NewLogger()
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/user/webhooks", bytes.NewBufferString(tt.body))
+			cookieStr, _ := sc.Encode(sessionName, tt.cookieValue)
+			req.Header.Set("Cookie", fmt.Sprintf("%s=%s", sessionName, cookieStr))
+			h := &Handler{
+				Storage:      s,
+				logger:       *logger,
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+			}
+
+			s.EXPECT().CreateWebhook(gomock.Any(), "test", gomock.Any()).Return(tt.statusCode, tt.errFromDB).AnyTimes()
+			h.Auth(h.CreateWebhook()).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestHandler_GetWebhooks(t *testing.T) {
+	tests := []struct {
+		name         string
+		answer       []storage.WebhookSubscription
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name: "Test 200",
+			answer: []storage.WebhookSubscription{
+				{ID: 1, URL: "https://example.com/hook", EventTypes: []string{"order.processed"}},
+			},
+			statusCode:   http.StatusOK,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test 204",
+			statusCode:   http.StatusNoContent,
+			errFromDB:    errors.New("no one webhook"),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Test 500",
+			statusCode:   http.StatusInternalServerError,
+			errFromDB:    errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			logger := loggers.NewLogger()
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/admin/webhooks", nil)
+			req.Header.Set("Authorization", "Bearer admin")
+			h := &Handler{
+				Storage:      s,
+				logger:       *logger,
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+				cfg:          config.ServerConfig{AdminToken: "admin"},
+			}
+
+			//администратор работает с глобальными подписками, им соответствует пустой логин
+			s.EXPECT().GetWebhooks(gomock.Any(), "").Return(tt.statusCode, tt.answer, tt.errFromDB).AnyTimes()
+			h.AdminAuth(h.GetWebhooks()).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				var got []storage.WebhookSubscription
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.answer, got)
+			}
+		})
+	}
+}
+
+func TestHandler_AdminAuth(t *testing.T) {
+	tests := []struct {
+		name         string
+		adminToken   string
+		header       string
+		expectedCode int
+	}{
+		{
+			name:         "authorized",
+			adminToken:   "admin",
+			header:       "Bearer admin",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "wrong token",
+			adminToken:   "admin",
+			header:       "Bearer user",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "admin api disabled",
+			adminToken:   "",
+			header:       "Bearer ",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			})
+			h := &Handler{
+				logger: *loggers.NewLogger(),
+				cfg:    config.ServerConfig{AdminToken: tt.adminToken},
+			}
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/admin/webhooks", nil)
+			req.Header.Set("Authorization", tt.header)
+			h.AdminAuth(handler).ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestHandler_ReplayWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		statusCode   int
+		errFromDB    error
+		expectedCode int
+	}{
+		{
+			name:         "Test 202",
+			id:           "1",
+			statusCode:   http.StatusAccepted,
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "Test 404",
+			id:           "2",
+			statusCode:   http.StatusNotFound,
+			errFromDB:    errors.New("delivery 2 not found"),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 400",
+			id:           "abc",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			h := &Handler{
+				Storage:      s,
+				logger:       *loggers.NewLogger(),
+				sessionStore: sessions.NewCookieStore([]byte("secret")),
+				cfg:          config.ServerConfig{AdminToken: "admin"},
+			}
+			router := chi.NewRouter()
+			h.Register(router)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/admin/webhooks/deliveries/"+tt.id+"/replay", nil)
+			req.Header.Set("Authorization", "Bearer admin")
+			s.EXPECT().ReplayWebhookDelivery(gomock.Any(), "", gomock.Any()).Return(tt.statusCode, tt.errFromDB).AnyTimes()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
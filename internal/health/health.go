@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusError    = "error"
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+
+	checkTimeout = 2 * time.Second
+)
+
+// CheckFunc проверяет одну зависимость сервиса и возвращает ошибку, если она недоступна.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	critical bool
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Critical bool   `json:"critical"`
+}
+
+// InfoFunc возвращает справочные сведения о компоненте, которые не влияют на готовность.
+type InfoFunc func() interface{}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+	Info   map[string]interface{} `json:"info,omitempty"`
+}
+
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []check
+	info         map[string]InfoFunc
+	shuttingDown int32
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddCheck регистрирует проверку зависимости. Если critical = false, то ошибка
+// отражается в отчете, но не переводит сервис в состояние not ready.
+func (c *Checker) AddCheck(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn, critical: critical})
+}
+
+// AddInfo регистрирует источник справочных сведений для отчета готовности.
+func (c *Checker) AddInfo(name string, fn InfoFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info == nil {
+		c.info = make(map[string]InfoFunc)
+	}
+	c.info[name] = fn
+}
+
+// SetShuttingDown переводит сервис в состояние not ready на время graceful shutdown.
+func (c *Checker) SetShuttingDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+func (c *Checker) IsShuttingDown() bool {
+	return atomic.LoadInt32(&c.shuttingDown) == 1
+}
+
+func (c *Checker) Register(r *chi.Mux) {
+	r.Get("/healthz", c.Liveness())
+	r.Get("/readyz", c.Readiness())
+}
+
+func (c *Checker) Liveness() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, map[string]string{"status": StatusOK})
+	}
+}
+
+func (c *Checker) Readiness() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		report := c.Check(r.Context())
+		statusCode := http.StatusOK
+		if report.Status != StatusReady {
+			statusCode = http.StatusServiceUnavailable
+		}
+		writeJSON(rw, statusCode, report)
+	}
+}
+
+// Check выполняет все проверки параллельно и собирает отчет по каждой зависимости.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make([]check, len(c.checks))
+	copy(checks, c.checks)
+	var info map[string]interface{}
+	if len(c.info) > 0 {
+		info = make(map[string]interface{}, len(c.info))
+		for name, fn := range c.info {
+			info[name] = fn()
+		}
+	}
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = CheckResult{Status: StatusOK, Critical: ch.critical}
+			if err := ch.fn(ctx); err != nil {
+				results[i].Status = StatusError
+				results[i].Error = err.Error()
+			}
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status: StatusReady,
+		Checks: make(map[string]CheckResult, len(checks)+1),
+		Info:   info,
+	}
+	for i, ch := range checks {
+		report.Checks[ch.name] = results[i]
+		if ch.critical && results[i].Status != StatusOK {
+			report.Status = StatusNotReady
+		}
+	}
+	if c.IsShuttingDown() {
+		report.Status = StatusNotReady
+		report.Checks["shutdown"] = CheckResult{Status: StatusError, Error: "server is shutting down", Critical: true}
+	}
+	return report
+}
+
+func writeJSON(rw http.ResponseWriter, statusCode int, v interface{}) {
+	result, err := json.Marshal(v)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+	rw.Write(result)
+}
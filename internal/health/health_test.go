@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Liveness(t *testing.T) {
+	c := NewChecker()
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+	c.Liveness().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestChecker_Readiness(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("down") }
+
+	tests := []struct {
+		name           string
+		critical       CheckFunc
+		optional       CheckFunc
+		shuttingDown   bool
+		expectedCode   int
+		expectedStatus string
+	}{
+		{
+			name:           "all ok",
+			critical:       ok,
+			optional:       ok,
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusReady,
+		},
+		{
+			name:           "optional check failed",
+			critical:       ok,
+			optional:       fail,
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusReady,
+		},
+		{
+			name:           "critical check failed",
+			critical:       fail,
+			optional:       ok,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusNotReady,
+		},
+		{
+			name:           "shutting down",
+			critical:       ok,
+			optional:       ok,
+			shuttingDown:   true,
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusNotReady,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker()
+			c.AddCheck("database", true, tt.critical)
+			c.AddCheck("accrual_agent", false, tt.optional)
+			if tt.shuttingDown {
+				c.SetShuttingDown()
+			}
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+			c.Readiness().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			var report Report
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+			assert.Equal(t, tt.expectedStatus, report.Status)
+			assert.Contains(t, report.Checks, "database")
+			assert.Contains(t, report.Checks, "accrual_agent")
+		})
+	}
+}
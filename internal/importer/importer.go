@@ -0,0 +1,311 @@
+// Package importer загружает пользователей и заказы из файлов миграции со старой системы
+// лояльности. Строки проверяются и загружаются пакетами через COPY; номер последней
+// загруженной строки хранится в БД, поэтому прерванный импорт продолжается с места остановки.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// виды загружаемых данных
+const (
+	KindUsers  = "users"
+	KindOrders = "orders"
+)
+
+// статусы, с которыми можно загрузить заказ
+var orderStatuses = map[string]bool{
+	"NEW":        true,
+	"REGISTERED": true,
+	"PROCESSING": true,
+	"INVALID":    true,
+	"PROCESSED":  true,
+}
+
+type Store interface {
+	Valid(order string) bool
+	ImportProgress(ctx context.Context, source string) (int64, error)
+	ImportUsers(ctx context.Context, source string, line int64, users []storage.ImportUser) ([]storage.ImportRejection, error)
+	ImportOrders(ctx context.Context, source string, line int64, orders []storage.ImportOrder) ([]storage.ImportRejection, error)
+}
+
+// Stats — итоги загрузки одного файла.
+type Stats struct {
+	Read     int64
+	Skipped  int64
+	Imported int64
+	Rejected int64
+}
+
+type Importer struct {
+	store     Store
+	logger    loggers.Logger
+	report    *Report
+	batchSize int
+}
+
+func New(store Store, logger loggers.Logger, report *Report, batchSize int) *Importer {
+	return &Importer{
+		store:     store,
+		logger:    logger,
+		report:    report,
+		batchSize: batchSize,
+	}
+}
+
+// batch — строки файла, накопленные до загрузки одним COPY.
+type batch struct {
+	lines    int
+	last     int64
+	users    []storage.ImportUser
+	orders   []storage.ImportOrder
+	rejected []storage.ImportRejection
+	raw      map[int64]string
+}
+
+// Run загружает файл path вида kind. Строки, загруженные предыдущими запусками, пропускаются.
+// При отмене ctx импорт останавливается после текущего пакета.
+func (i *Importer) Run(ctx context.Context, kind, path string) (Stats, error) {
+	var stats Stats
+	if kind != KindUsers && kind != KindOrders {
+		return stats, fmt.Errorf("unknown import kind %s", kind)
+	}
+	format, err := formatOf(path)
+	if err != nil {
+		return stats, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return stats, err
+	}
+	source := kind + ":" + abs
+	done, err := i.store.ImportProgress(ctx, source)
+	if err != nil {
+		return stats, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+	r, err := newReader(format, f)
+	if err != nil {
+		return stats, err
+	}
+	//повторы внутри файла; повторы с уже загруженными данными отсекает БД
+	seen := make(map[string]bool)
+	b := &batch{raw: make(map[int64]string)}
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Read++
+		if rec.line <= done {
+			stats.Skipped++
+			continue
+		}
+		b.lines++
+		b.last = rec.line
+		b.raw[rec.line] = rec.raw
+		if reason := i.add(b, kind, rec, seen); reason != "" {
+			b.rejected = append(b.rejected, storage.ImportRejection{Line: rec.line, Reason: reason})
+		}
+		if b.lines >= i.batchSize {
+			if err = i.flush(ctx, kind, source, b, &stats); err != nil {
+				return stats, err
+			}
+			b = &batch{raw: make(map[int64]string)}
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+		}
+	}
+	if b.lines > 0 {
+		if err = i.flush(ctx, kind, source, b, &stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// add проверяет строку и добавляет ее в пакет; возвращает причину отказа.
+func (i *Importer) add(b *batch, kind string, rec record, seen map[string]bool) string {
+	if rec.err != nil {
+		return fmt.Sprintf("malformed line: %v", rec.err)
+	}
+	if kind == KindUsers {
+		u, reason := parseUser(rec)
+		if reason != "" {
+			return reason
+		}
+		if seen[u.Login] {
+			return "duplicate login in file"
+		}
+		seen[u.Login] = true
+		b.users = append(b.users, u)
+		return ""
+	}
+	o, reason := parseOrder(rec, i.store.Valid)
+	if reason != "" {
+		return reason
+	}
+	if seen[o.Number] {
+		return "duplicate order in file"
+	}
+	seen[o.Number] = true
+	b.orders = append(b.orders, o)
+	return ""
+}
+
+// flush загружает пакет и записывает отклоненные строки в отчет.
+func (i *Importer) flush(ctx context.Context, kind, source string, b *batch, stats *Stats) error {
+	var rejected []storage.ImportRejection
+	var err error
+	if kind == KindUsers {
+		rejected, err = i.store.ImportUsers(ctx, source, b.last, b.users)
+		stats.Imported += int64(len(b.users) - len(rejected))
+	} else {
+		rejected, err = i.store.ImportOrders(ctx, source, b.last, b.orders)
+		stats.Imported += int64(len(b.orders) - len(rejected))
+	}
+	if err != nil {
+		return err
+	}
+	rejected = append(rejected, b.rejected...)
+	sort.Slice(rejected, func(x, y int) bool { return rejected[x].Line < rejected[y].Line })
+	stats.Rejected += int64(len(rejected))
+	if err = i.report.Write(source, rejected, b.raw); err != nil {
+		return err
+	}
+	i.logger.LogInfo("line", strconv.FormatInt(b.last, 10), "import batch of "+source+" is loaded")
+	return nil
+}
+
+func parseUser(rec record) (storage.ImportUser, string) {
+	u := storage.ImportUser{Line: rec.line, Login: rec.fields["login"], HashedPassword: rec.fields["hashed_password"]}
+	if u.Login == "" || len(u.Login) > 200 {
+		return u, "login is empty or longer than 200 characters"
+	}
+	//хэши переносятся без изменений и должны совпадать с форматом хранилища — HMAC-SHA256 в hex
+	if _, err := hex.DecodeString(u.HashedPassword); err != nil || len(u.HashedPassword) != 64 {
+		return u, "hashed_password is not a hex encoded HMAC-SHA256"
+	}
+	var err error
+	if u.Current, err = parseAmount(rec.fields["balance_current"]); err != nil {
+		return u, "wrong balance_current: " + err.Error()
+	}
+	if u.Withdrawn, err = parseAmount(rec.fields["balance_withdrawn"]); err != nil {
+		return u, "wrong balance_withdrawn: " + err.Error()
+	}
+	return u, ""
+}
+
+func parseOrder(rec record, valid func(string) bool) (storage.ImportOrder, string) {
+	o := storage.ImportOrder{
+		Line:   rec.line,
+		Login:  rec.fields["login"],
+		Number: rec.fields["number"],
+		Status: rec.fields["status"],
+	}
+	if o.Login == "" {
+		return o, "login is empty"
+	}
+	if !valid(o.Number) {
+		return o, "wrong order number"
+	}
+	if o.Status == "" {
+		o.Status = "NEW"
+	}
+	if !orderStatuses[o.Status] {
+		return o, "unknown status " + o.Status
+	}
+	var err error
+	if o.Accrual, err = parseAmount(rec.fields["accrual"]); err != nil {
+		return o, "wrong accrual: " + err.Error()
+	}
+	o.UploadedAt = time.Now()
+	if v := rec.fields["uploaded_at"]; v != "" {
+		if o.UploadedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			return o, "wrong uploaded_at, expected RFC3339"
+		}
+	}
+	return o, ""
+}
+
+// parseAmount разбирает неотрицательную сумму баллов; пустое значение — 0.
+func parseAmount(v string) (float64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	if amount < 0 {
+		return 0, fmt.Errorf("negative amount %v", amount)
+	}
+	return amount, nil
+}
+
+// Report — CSV-отчет об отклоненных строках с колонками source,line,reason,record.
+type Report struct {
+	f *os.File
+	w *csv.Writer
+}
+
+// OpenReport открывает отчет на дозапись; заголовок пишется только в новый файл.
+func OpenReport(path string) (*Report, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := &Report{f: f, w: csv.NewWriter(f)}
+	if info.Size() == 0 {
+		if err = r.w.Write([]string{"source", "line", "reason", "record"}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Report) Write(source string, rejected []storage.ImportRejection, raw map[int64]string) error {
+	for _, rej := range rejected {
+		err := r.w.Write([]string{source, strconv.FormatInt(rej.Line, 10), rej.Reason, raw[rej.Line]})
+		if err != nil {
+			return err
+		}
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *Report) Close() error {
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+const testHash = "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"
+
+// fakeStore хранит загруженные данные в памяти; логины и номера из existing считаются уже загруженными.
+type fakeStore struct {
+	existing map[string]bool
+	progress map[string]int64
+	batches  int
+	users    []storage.ImportUser
+	orders   []storage.ImportOrder
+}
+
+func newFakeStore(existing ...string) *fakeStore {
+	s := &fakeStore{existing: make(map[string]bool), progress: make(map[string]int64)}
+	for _, e := range existing {
+		s.existing[e] = true
+	}
+	return s
+}
+
+func (s *fakeStore) Valid(order string) bool {
+	return order == "12345678903" || order == "2377225624" || order == "49927398716"
+}
+
+func (s *fakeStore) ImportProgress(ctx context.Context, source string) (int64, error) {
+	return s.progress[source], nil
+}
+
+func (s *fakeStore) ImportUsers(ctx context.Context, source string, line int64, users []storage.ImportUser) ([]storage.ImportRejection, error) {
+	s.batches++
+	s.progress[source] = line
+	var rejected []storage.ImportRejection
+	for _, u := range users {
+		if s.existing[u.Login] {
+			rejected = append(rejected, storage.ImportRejection{Line: u.Line, Reason: "login already exists"})
+			continue
+		}
+		s.users = append(s.users, u)
+	}
+	return rejected, nil
+}
+
+func (s *fakeStore) ImportOrders(ctx context.Context, source string, line int64, orders []storage.ImportOrder) ([]storage.ImportRejection, error) {
+	s.batches++
+	s.progress[source] = line
+	var rejected []storage.ImportRejection
+	for _, o := range orders {
+		if s.existing[o.Number] {
+			rejected = append(rejected, storage.ImportRejection{Line: o.Line, Reason: "order already exists"})
+			continue
+		}
+		s.orders = append(s.orders, o)
+	}
+	return rejected, nil
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func readReport(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	assert.NoError(t, err)
+	return records
+}
+
+func TestImporter_Users(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "users.csv", strings.Join([]string{
+		"login,hashed_password,balance_current,balance_withdrawn",
+		"alice," + testHash + ",100,20",
+		"bob,short,0,0",
+		"alice," + testHash + ",1,0",
+		"carol," + testHash + ",-5,0",
+		"dave," + testHash,
+		"erin," + testHash + ",,",
+		"old," + testHash + ",10,0",
+	}, "\n"))
+	reportPath := filepath.Join(dir, "rejects.csv")
+	report, err := OpenReport(reportPath)
+	assert.NoError(t, err)
+	store := newFakeStore("old")
+	stats, err := New(store, *loggers.NewLogger(), report, 3).Run(context.Background(), KindUsers, path)
+	assert.NoError(t, err)
+	assert.NoError(t, report.Close())
+
+	assert.Equal(t, Stats{Read: 7, Imported: 2, Rejected: 5}, stats)
+	assert.Equal(t, 3, store.batches)
+	if assert.Len(t, store.users, 2) {
+		assert.Equal(t, storage.ImportUser{Line: 2, Login: "alice", HashedPassword: testHash, Current: 100, Withdrawn: 20}, store.users[0])
+		assert.Equal(t, "erin", store.users[1].Login)
+	}
+	records := readReport(t, reportPath)
+	assert.Equal(t, []string{"source", "line", "reason", "record"}, records[0])
+	var lines []string
+	for _, r := range records[1:] {
+		lines = append(lines, r[1])
+	}
+	assert.Equal(t, []string{"3", "4", "5", "6", "8"}, lines)
+	assert.Equal(t, "duplicate login in file", records[2][2])
+	assert.Equal(t, "login already exists", records[5][2])
+}
+
+func TestImporter_OrdersResume(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "orders.jsonl", strings.Join([]string{
+		`{"login":"alice","number":"12345678903","status":"PROCESSED","accrual":500,"uploaded_at":"2020-01-02T03:04:05Z"}`,
+		`{"login":"alice","number":"123"}`,
+		``,
+		`{"login":"alice","number":"2377225624","status":"DONE"}`,
+		`{"login":"alice","number":"2377225624"}`,
+		`not json`,
+		`{"login":"bob","number":"49927398716","status":"NEW"}`,
+	}, "\n"))
+	report, err := OpenReport(filepath.Join(dir, "rejects.csv"))
+	assert.NoError(t, err)
+	defer report.Close()
+	store := newFakeStore()
+	abs, err := filepath.Abs(path)
+	assert.NoError(t, err)
+	//первые четыре строки загружены прерванным запуском
+	store.progress[KindOrders+":"+abs] = 4
+	stats, err := New(store, *loggers.NewLogger(), report, 100).Run(context.Background(), KindOrders, path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, Stats{Read: 6, Skipped: 3, Imported: 2, Rejected: 1}, stats)
+	if assert.Len(t, store.orders, 2) {
+		assert.Equal(t, "2377225624", store.orders[0].Number)
+		assert.Equal(t, "NEW", store.orders[0].Status)
+		assert.Equal(t, "49927398716", store.orders[1].Number)
+	}
+	assert.Equal(t, int64(7), store.progress[KindOrders+":"+abs])
+}
+
+func TestParseOrder(t *testing.T) {
+	valid := func(string) bool { return true }
+	tests := []struct {
+		name   string
+		fields map[string]string
+		reason string
+	}{
+		{name: "ok", fields: map[string]string{"login": "a", "number": "1", "status": "PROCESSED", "accrual": "10.5"}},
+		{name: "no login", fields: map[string]string{"number": "1"}, reason: "login is empty"},
+		{name: "status", fields: map[string]string{"login": "a", "number": "1", "status": "FAILED"}, reason: "unknown status FAILED"},
+		{name: "accrual", fields: map[string]string{"login": "a", "number": "1", "accrual": "x"}, reason: "wrong accrual: strconv.ParseFloat: parsing \"x\": invalid syntax"},
+		{name: "date", fields: map[string]string{"login": "a", "number": "1", "uploaded_at": "2020-01-02"}, reason: "wrong uploaded_at, expected RFC3339"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, reason := parseOrder(record{line: 1, fields: tt.fields}, valid)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestRun_UnknownFormat(t *testing.T) {
+	_, err := New(newFakeStore(), *loggers.NewLogger(), nil, 10).Run(context.Background(), KindUsers, "users.xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// форматы файлов миграции
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// maxLineSize — наибольшая длина строки JSONL.
+const maxLineSize = 1 << 20
+
+// record — строка файла миграции: значения полей по именам столбцов и исходный текст для отчета.
+type record struct {
+	line   int64
+	fields map[string]string
+	raw    string
+	err    error
+}
+
+type reader interface {
+	// next возвращает следующую строку или io.EOF. Ошибка разбора строки возвращается
+	// в record.err, и чтение можно продолжать.
+	next() (record, error)
+}
+
+// formatOf определяет формат файла по расширению.
+func formatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unknown format of %s, expected .csv or .jsonl", path)
+	}
+}
+
+func newReader(format string, r io.Reader) (reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 64*1024), maxLineSize)
+		return &jsonlReader{s: s}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// csvReader читает CSV, первая строка которого содержит имена столбцов.
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make([]string, len(header))
+	for i, h := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(h))
+	}
+	//число полей в строках сверяется с заголовком
+	cr.FieldsPerRecord = len(columns)
+	return &csvReader{r: cr, header: columns}, nil
+}
+
+func (c *csvReader) next() (record, error) {
+	values, err := c.r.Read()
+	if err == io.EOF {
+		return record{}, err
+	}
+	var parseErr *csv.ParseError
+	if err != nil && !errors.As(err, &parseErr) {
+		return record{}, err
+	}
+	rec := record{raw: strings.Join(values, ","), err: err}
+	if parseErr != nil {
+		rec.line = int64(parseErr.StartLine)
+		return rec, nil
+	}
+	line, _ := c.r.FieldPos(0)
+	rec.line = int64(line)
+	rec.fields = make(map[string]string, len(values))
+	for i, v := range values {
+		rec.fields[c.header[i]] = strings.TrimSpace(v)
+	}
+	return rec, nil
+}
+
+// jsonlReader читает по одному JSON-объекту в строке; пустые строки пропускаются.
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int64
+}
+
+func (j *jsonlReader) next() (record, error) {
+	for j.s.Scan() {
+		j.line++
+		data := bytes.TrimSpace(j.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		rec := record{line: j.line, raw: string(data)}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			rec.err = err
+			return rec, nil
+		}
+		rec.fields = make(map[string]string, len(obj))
+		for k, v := range obj {
+			//строки передаются без кавычек, числа — как записаны в файле
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				s = string(v)
+			}
+			if s == "null" {
+				s = ""
+			}
+			rec.fields[strings.ToLower(k)] = strings.TrimSpace(s)
+		}
+		return rec, nil
+	}
+	if err := j.s.Err(); err != nil {
+		return record{}, err
+	}
+	return record{}, io.EOF
+}
@@ -5,7 +5,9 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	storage "github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
 	gomock "github.com/golang/mock/gomock"
@@ -34,55 +36,270 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// CancelOrder mocks base method.
+func (m *MockStorage) CancelOrder(arg0 context.Context, arg1, arg2 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelOrder", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelOrder indicates an expected call of CancelOrder.
+func (mr *MockStorageMockRecorder) CancelOrder(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelOrder", reflect.TypeOf((*MockStorage)(nil).CancelOrder), arg0, arg1, arg2)
+}
+
+// CaptureHold mocks base method.
+func (m *MockStorage) CaptureHold(arg0 context.Context, arg1 string, arg2 int64) (int, *storage.Hold, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CaptureHold", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*storage.Hold)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CaptureHold indicates an expected call of CaptureHold.
+func (mr *MockStorageMockRecorder) CaptureHold(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CaptureHold", reflect.TypeOf((*MockStorage)(nil).CaptureHold), arg0, arg1, arg2)
+}
+
+// ClaimOrders mocks base method.
+func (m *MockStorage) ClaimOrders(arg0 context.Context, arg1 string, arg2 int, arg3 time.Duration) ([]storage.Orders, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOrders", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]storage.Orders)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOrders indicates an expected call of ClaimOrders.
+func (mr *MockStorageMockRecorder) ClaimOrders(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOrders", reflect.TypeOf((*MockStorage)(nil).ClaimOrders), arg0, arg1, arg2, arg3)
+}
+
+// Clawback mocks base method.
+func (m *MockStorage) Clawback(arg0 context.Context, arg1 string, arg2 *storage.Clawback) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clawback", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clawback indicates an expected call of Clawback.
+func (mr *MockStorageMockRecorder) Clawback(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clawback", reflect.TypeOf((*MockStorage)(nil).Clawback), arg0, arg1, arg2)
+}
+
 // CollectOrder mocks base method.
-func (m *MockStorage) CollectOrder(arg0, arg1 string) (int, error) {
+func (m *MockStorage) CollectOrder(arg0 context.Context, arg1, arg2 string) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CollectOrder", arg0, arg1)
+	ret := m.ctrl.Call(m, "CollectOrder", arg0, arg1, arg2)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CollectOrder indicates an expected call of CollectOrder.
-func (mr *MockStorageMockRecorder) CollectOrder(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) CollectOrder(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectOrder", reflect.TypeOf((*MockStorage)(nil).CollectOrder), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectOrder", reflect.TypeOf((*MockStorage)(nil).CollectOrder), arg0, arg1, arg2)
 }
 
-// GetAllOrders mocks base method.
-func (m *MockStorage) GetAllOrders() ([]storage.Orders, error) {
+// CreateCampaign mocks base method.
+func (m *MockStorage) CreateCampaign(arg0 context.Context, arg1 *storage.Campaign) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllOrders")
-	ret0, _ := ret[0].([]storage.Orders)
+	ret := m.ctrl.Call(m, "CreateCampaign", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCampaign indicates an expected call of CreateCampaign.
+func (mr *MockStorageMockRecorder) CreateCampaign(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCampaign", reflect.TypeOf((*MockStorage)(nil).CreateCampaign), arg0, arg1)
+}
+
+// CreateHold mocks base method.
+func (m *MockStorage) CreateHold(arg0 context.Context, arg1 string, arg2 *storage.Hold) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateHold", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateHold indicates an expected call of CreateHold.
+func (mr *MockStorageMockRecorder) CreateHold(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateHold", reflect.TypeOf((*MockStorage)(nil).CreateHold), arg0, arg1, arg2)
+}
+
+// CreateWebhook mocks base method.
+func (m *MockStorage) CreateWebhook(arg0 context.Context, arg1 string, arg2 *storage.WebhookSubscription) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockStorageMockRecorder) CreateWebhook(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockStorage)(nil).CreateWebhook), arg0, arg1, arg2)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockStorage) DeleteWebhook(arg0 context.Context, arg1 string, arg2 int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAllOrders indicates an expected call of GetAllOrders.
-func (mr *MockStorageMockRecorder) GetAllOrders() *gomock.Call {
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockStorageMockRecorder) DeleteWebhook(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllOrders", reflect.TypeOf((*MockStorage)(nil).GetAllOrders))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockStorage)(nil).DeleteWebhook), arg0, arg1, arg2)
+}
+
+// ExpireHolds mocks base method.
+func (m *MockStorage) ExpireHolds(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireHolds", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireHolds indicates an expected call of ExpireHolds.
+func (mr *MockStorageMockRecorder) ExpireHolds(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireHolds", reflect.TypeOf((*MockStorage)(nil).ExpireHolds), arg0)
+}
+
+// ExpirePoints mocks base method.
+func (m *MockStorage) ExpirePoints(arg0 context.Context, arg1 bool) ([]storage.PointsExpiry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpirePoints", arg0, arg1)
+	ret0, _ := ret[0].([]storage.PointsExpiry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpirePoints indicates an expected call of ExpirePoints.
+func (mr *MockStorageMockRecorder) ExpirePoints(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpirePoints", reflect.TypeOf((*MockStorage)(nil).ExpirePoints), arg0, arg1)
+}
+
+// FailStaleOrders mocks base method.
+func (m *MockStorage) FailStaleOrders(arg0 context.Context, arg1 time.Duration) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailStaleOrders", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FailStaleOrders indicates an expected call of FailStaleOrders.
+func (mr *MockStorageMockRecorder) FailStaleOrders(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailStaleOrders", reflect.TypeOf((*MockStorage)(nil).FailStaleOrders), arg0, arg1)
 }
 
 // GetBalance mocks base method.
-func (m *MockStorage) GetBalance(arg0 string) (*storage.Balance, error) {
+func (m *MockStorage) GetBalance(arg0 context.Context, arg1 string) (*storage.Balance, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBalance", arg0)
+	ret := m.ctrl.Call(m, "GetBalance", arg0, arg1)
 	ret0, _ := ret[0].(*storage.Balance)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBalance indicates an expected call of GetBalance.
-func (mr *MockStorageMockRecorder) GetBalance(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetBalance(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockStorage)(nil).GetBalance), arg0, arg1)
+}
+
+// GetCampaignRedemptions mocks base method.
+func (m *MockStorage) GetCampaignRedemptions(arg0 context.Context, arg1 int64) (int, []storage.PromoRedemption, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaignRedemptions", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.PromoRedemption)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetCampaignRedemptions indicates an expected call of GetCampaignRedemptions.
+func (mr *MockStorageMockRecorder) GetCampaignRedemptions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaignRedemptions", reflect.TypeOf((*MockStorage)(nil).GetCampaignRedemptions), arg0, arg1)
+}
+
+// GetCampaigns mocks base method.
+func (m *MockStorage) GetCampaigns(arg0 context.Context) (int, []storage.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaigns", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.Campaign)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetCampaigns indicates an expected call of GetCampaigns.
+func (mr *MockStorageMockRecorder) GetCampaigns(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaigns", reflect.TypeOf((*MockStorage)(nil).GetCampaigns), arg0)
+}
+
+// GetFailedOrders mocks base method.
+func (m *MockStorage) GetFailedOrders(arg0 context.Context) (int, []storage.Orders, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFailedOrders", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.Orders)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetFailedOrders indicates an expected call of GetFailedOrders.
+func (mr *MockStorageMockRecorder) GetFailedOrders(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFailedOrders", reflect.TypeOf((*MockStorage)(nil).GetFailedOrders), arg0)
+}
+
+// GetHolds mocks base method.
+func (m *MockStorage) GetHolds(arg0 context.Context, arg1 string) (int, []storage.Hold, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHolds", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.Hold)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetHolds indicates an expected call of GetHolds.
+func (mr *MockStorageMockRecorder) GetHolds(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockStorage)(nil).GetBalance), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHolds", reflect.TypeOf((*MockStorage)(nil).GetHolds), arg0, arg1)
 }
 
 // GetOrder mocks base method.
-func (m *MockStorage) GetOrder(arg0 string) (int, []storage.Orders, error) {
+func (m *MockStorage) GetOrder(arg0 context.Context, arg1 string) (int, []storage.Orders, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrder", arg0)
+	ret := m.ctrl.Call(m, "GetOrder", arg0, arg1)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].([]storage.Orders)
 	ret2, _ := ret[2].(error)
@@ -90,86 +307,303 @@ func (m *MockStorage) GetOrder(arg0 string) (int, []storage.Orders, error) {
 }
 
 // GetOrder indicates an expected call of GetOrder.
-func (mr *MockStorageMockRecorder) GetOrder(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetOrder(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockStorage)(nil).GetOrder), arg0, arg1)
+}
+
+// GetOrderDetail mocks base method.
+func (m *MockStorage) GetOrderDetail(arg0 context.Context, arg1, arg2 string) (int, *storage.OrderDetail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderDetail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*storage.OrderDetail)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetOrderDetail indicates an expected call of GetOrderDetail.
+func (mr *MockStorageMockRecorder) GetOrderDetail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderDetail", reflect.TypeOf((*MockStorage)(nil).GetOrderDetail), arg0, arg1, arg2)
+}
+
+// GetRefunds mocks base method.
+func (m *MockStorage) GetRefunds(arg0 context.Context, arg1 string) (int, []storage.Refund, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRefunds", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.Refund)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetRefunds indicates an expected call of GetRefunds.
+func (mr *MockStorageMockRecorder) GetRefunds(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockStorage)(nil).GetOrder), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefunds", reflect.TypeOf((*MockStorage)(nil).GetRefunds), arg0, arg1)
+}
+
+// GetTierHistory mocks base method.
+func (m *MockStorage) GetTierHistory(arg0 context.Context, arg1 string) (int, []storage.TierChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTierHistory", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.TierChange)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTierHistory indicates an expected call of GetTierHistory.
+func (mr *MockStorageMockRecorder) GetTierHistory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTierHistory", reflect.TypeOf((*MockStorage)(nil).GetTierHistory), arg0, arg1)
+}
+
+// GetUserID mocks base method.
+func (m *MockStorage) GetUserID(arg0 context.Context, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserID", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserID indicates an expected call of GetUserID.
+func (mr *MockStorageMockRecorder) GetUserID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserID", reflect.TypeOf((*MockStorage)(nil).GetUserID), arg0, arg1)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockStorage) GetWebhookDeliveries(arg0 context.Context, arg1 string, arg2 int64) (int, []storage.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.WebhookDelivery)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockStorageMockRecorder) GetWebhookDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockStorage)(nil).GetWebhookDeliveries), arg0, arg1, arg2)
+}
+
+// GetWebhooks mocks base method.
+func (m *MockStorage) GetWebhooks(arg0 context.Context, arg1 string) (int, []storage.WebhookSubscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.WebhookSubscription)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockStorageMockRecorder) GetWebhooks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockStorage)(nil).GetWebhooks), arg0, arg1)
 }
 
 // Login mocks base method.
-func (m *MockStorage) Login(arg0 *storage.AcceptUser) error {
+func (m *MockStorage) Login(arg0 context.Context, arg1 *storage.AcceptUser) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Login", arg0)
+	ret := m.ctrl.Call(m, "Login", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Login indicates an expected call of Login.
-func (mr *MockStorageMockRecorder) Login(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) Login(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockStorage)(nil).Login), arg0, arg1)
+}
+
+// RedeemPromo mocks base method.
+func (m *MockStorage) RedeemPromo(arg0 context.Context, arg1, arg2 string) (int, *storage.PromoRedemption, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedeemPromo", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*storage.PromoRedemption)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RedeemPromo indicates an expected call of RedeemPromo.
+func (mr *MockStorageMockRecorder) RedeemPromo(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockStorage)(nil).Login), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedeemPromo", reflect.TypeOf((*MockStorage)(nil).RedeemPromo), arg0, arg1, arg2)
+}
+
+// RefundWithdrawal mocks base method.
+func (m *MockStorage) RefundWithdrawal(arg0 context.Context, arg1 string, arg2 *storage.Refund) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundWithdrawal", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefundWithdrawal indicates an expected call of RefundWithdrawal.
+func (mr *MockStorageMockRecorder) RefundWithdrawal(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundWithdrawal", reflect.TypeOf((*MockStorage)(nil).RefundWithdrawal), arg0, arg1, arg2)
 }
 
 // Register mocks base method.
-func (m *MockStorage) Register(arg0 *storage.AcceptUser) error {
+func (m *MockStorage) Register(arg0 context.Context, arg1 *storage.AcceptUser) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Register", arg0)
+	ret := m.ctrl.Call(m, "Register", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Register indicates an expected call of Register.
-func (mr *MockStorageMockRecorder) Register(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) Register(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockStorage)(nil).Register), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockStorage)(nil).Register), arg0, arg1)
 }
 
-// UpdateOrders mocks base method.
-func (m *MockStorage) UpdateOrders(arg0 []storage.Orders) error {
+// ReleaseHold mocks base method.
+func (m *MockStorage) ReleaseHold(arg0 context.Context, arg1 string, arg2 int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseHold", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseHold indicates an expected call of ReleaseHold.
+func (mr *MockStorageMockRecorder) ReleaseHold(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseHold", reflect.TypeOf((*MockStorage)(nil).ReleaseHold), arg0, arg1, arg2)
+}
+
+// ReleaseOrders mocks base method.
+func (m *MockStorage) ReleaseOrders(arg0 context.Context, arg1 string, arg2 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrders", arg0)
+	ret := m.ctrl.Call(m, "ReleaseOrders", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateOrders indicates an expected call of UpdateOrders.
-func (mr *MockStorageMockRecorder) UpdateOrders(arg0 interface{}) *gomock.Call {
+// ReleaseOrders indicates an expected call of ReleaseOrders.
+func (mr *MockStorageMockRecorder) ReleaseOrders(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseOrders", reflect.TypeOf((*MockStorage)(nil).ReleaseOrders), arg0, arg1, arg2)
+}
+
+// ReplayWebhookDelivery mocks base method.
+func (m *MockStorage) ReplayWebhookDelivery(arg0 context.Context, arg1 string, arg2 int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplayWebhookDelivery", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplayWebhookDelivery indicates an expected call of ReplayWebhookDelivery.
+func (mr *MockStorageMockRecorder) ReplayWebhookDelivery(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrders", reflect.TypeOf((*MockStorage)(nil).UpdateOrders), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplayWebhookDelivery", reflect.TypeOf((*MockStorage)(nil).ReplayWebhookDelivery), arg0, arg1, arg2)
 }
 
-// UpdateUserBalance mocks base method.
-func (m *MockStorage) UpdateUserBalance(arg0 []storage.Orders) error {
+// RescheduleOrders mocks base method.
+func (m *MockStorage) RescheduleOrders(arg0 context.Context, arg1 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUserBalance", arg0)
+	ret := m.ctrl.Call(m, "RescheduleOrders", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateUserBalance indicates an expected call of UpdateUserBalance.
-func (mr *MockStorageMockRecorder) UpdateUserBalance(arg0 interface{}) *gomock.Call {
+// RescheduleOrders indicates an expected call of RescheduleOrders.
+func (mr *MockStorageMockRecorder) RescheduleOrders(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RescheduleOrders", reflect.TypeOf((*MockStorage)(nil).RescheduleOrders), arg0, arg1)
+}
+
+// Statement mocks base method.
+func (m *MockStorage) Statement(arg0 context.Context, arg1 string, arg2, arg3 time.Time, arg4 storage.StatementWriter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Statement", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Statement indicates an expected call of Statement.
+func (mr *MockStorageMockRecorder) Statement(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Statement", reflect.TypeOf((*MockStorage)(nil).Statement), arg0, arg1, arg2, arg3, arg4)
+}
+
+// Transfer mocks base method.
+func (m *MockStorage) Transfer(arg0 context.Context, arg1 string, arg2 *storage.Transfer) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transfer", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Transfer indicates an expected call of Transfer.
+func (mr *MockStorageMockRecorder) Transfer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transfer", reflect.TypeOf((*MockStorage)(nil).Transfer), arg0, arg1, arg2)
+}
+
+// Transfers mocks base method.
+func (m *MockStorage) Transfers(arg0 context.Context, arg1 string) (int, []storage.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transfers", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]storage.Transfer)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Transfers indicates an expected call of Transfers.
+func (mr *MockStorageMockRecorder) Transfers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transfers", reflect.TypeOf((*MockStorage)(nil).Transfers), arg0, arg1)
+}
+
+// UpdateOrders mocks base method.
+func (m *MockStorage) UpdateOrders(arg0 context.Context, arg1 string, arg2 []storage.Orders) ([]storage.Orders, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrders", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]storage.Orders)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateOrders indicates an expected call of UpdateOrders.
+func (mr *MockStorageMockRecorder) UpdateOrders(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserBalance", reflect.TypeOf((*MockStorage)(nil).UpdateUserBalance), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrders", reflect.TypeOf((*MockStorage)(nil).UpdateOrders), arg0, arg1, arg2)
 }
 
 // Withdraw mocks base method.
-func (m *MockStorage) Withdraw(arg0 string, arg1 *storage.Order) (int, error) {
+func (m *MockStorage) Withdraw(arg0 context.Context, arg1 string, arg2 *storage.Order) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Withdraw", arg0, arg1)
+	ret := m.ctrl.Call(m, "Withdraw", arg0, arg1, arg2)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Withdraw indicates an expected call of Withdraw.
-func (mr *MockStorageMockRecorder) Withdraw(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) Withdraw(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdraw", reflect.TypeOf((*MockStorage)(nil).Withdraw), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdraw", reflect.TypeOf((*MockStorage)(nil).Withdraw), arg0, arg1, arg2)
 }
 
 // Withdrawals mocks base method.
-func (m *MockStorage) Withdrawals(arg0 string) (int, []storage.Order, error) {
+func (m *MockStorage) Withdrawals(arg0 context.Context, arg1 string) (int, []storage.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Withdrawals", arg0)
+	ret := m.ctrl.Call(m, "Withdrawals", arg0, arg1)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].([]storage.Order)
 	ret2, _ := ret[2].(error)
@@ -177,7 +611,7 @@ func (m *MockStorage) Withdrawals(arg0 string) (int, []storage.Order, error) {
 }
 
 // Withdrawals indicates an expected call of Withdrawals.
-func (mr *MockStorageMockRecorder) Withdrawals(arg0 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) Withdrawals(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdrawals", reflect.TypeOf((*MockStorage)(nil).Withdrawals), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdrawals", reflect.TypeOf((*MockStorage)(nil).Withdrawals), arg0, arg1)
 }
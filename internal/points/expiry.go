@@ -0,0 +1,54 @@
+package points
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// Store — хранилище партий баллов.
+type Store interface {
+	ExpirePoints(ctx context.Context, dryRun bool) ([]storage.PointsExpiry, error)
+}
+
+// Expirer периодически списывает баллы с истекшим сроком действия. В режиме dryRun
+// баллы не списываются, а в журнал пишется отчет о том, что сгорело бы.
+type Expirer struct {
+	store  Store
+	logger loggers.Logger
+	dryRun bool
+}
+
+func NewExpirer(store Store, logger loggers.Logger, dryRun bool) *Expirer {
+	return &Expirer{
+		store:  store,
+		logger: logger,
+		dryRun: dryRun,
+	}
+}
+
+func (e *Expirer) Start(ticker time.Ticker) {
+	for range ticker.C {
+		e.Flush(context.Background())
+	}
+}
+
+// Flush выполняет один запуск и возвращает отчет по пользователям.
+func (e *Expirer) Flush(ctx context.Context) []storage.PointsExpiry {
+	report, err := e.store.ExpirePoints(ctx, e.dryRun)
+	if err != nil {
+		e.logger.LogErr(err, "failed to expire points")
+		return nil
+	}
+	for _, r := range report {
+		msg := "points expired"
+		if e.dryRun {
+			msg = "points would expire (dry run)"
+		}
+		e.logger.LogInfo("user_id", strconv.Itoa(r.UserID), msg+": "+strconv.FormatFloat(r.Amount, 'f', -1, 64))
+	}
+	return report
+}
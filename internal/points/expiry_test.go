@@ -0,0 +1,39 @@
+package points
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/mocks"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+func TestExpirer_Flush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockStorage(ctrl)
+	report := []storage.PointsExpiry{{UserID: 1, Amount: 250, Lots: 2}}
+
+	s.EXPECT().ExpirePoints(gomock.Any(), true).Return(report, nil)
+	assert.Equal(t, report, NewExpirer(s, *loggers.NewLogger(), true).Flush(context.Background()))
+
+	s.EXPECT().ExpirePoints(gomock.Any(), false).Return(nil, errors.New("err"))
+	assert.Nil(t, NewExpirer(s, *loggers.NewLogger(), false).Flush(context.Background()))
+}
+
+func TestHoldExpirer_Flush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockStorage(ctrl)
+
+	s.EXPECT().ExpireHolds(gomock.Any()).Return(3, nil)
+	assert.Equal(t, 3, NewHoldExpirer(s, *loggers.NewLogger()).Flush(context.Background()))
+
+	s.EXPECT().ExpireHolds(gomock.Any()).Return(0, errors.New("err"))
+	assert.Equal(t, 0, NewHoldExpirer(s, *loggers.NewLogger()).Flush(context.Background()))
+}
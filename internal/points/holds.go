@@ -0,0 +1,46 @@
+package points
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+)
+
+// HoldStore — хранилище удержаний баллов.
+type HoldStore interface {
+	ExpireHolds(ctx context.Context) (int, error)
+}
+
+// HoldExpirer периодически помечает удержания, которые не подтвердили вовремя.
+type HoldExpirer struct {
+	store  HoldStore
+	logger loggers.Logger
+}
+
+func NewHoldExpirer(store HoldStore, logger loggers.Logger) *HoldExpirer {
+	return &HoldExpirer{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (e *HoldExpirer) Start(ticker time.Ticker) {
+	for range ticker.C {
+		e.Flush(context.Background())
+	}
+}
+
+// Flush выполняет один запуск и возвращает число снятых удержаний.
+func (e *HoldExpirer) Flush(ctx context.Context) int {
+	n, err := e.store.ExpireHolds(ctx)
+	if err != nil {
+		e.logger.LogErr(err, "failed to expire holds")
+		return 0
+	}
+	if n > 0 {
+		e.logger.LogInfo("holds", strconv.Itoa(n), "holds expired")
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+// Package policy проверяет списания баллов по настраиваемым правилам.
+package policy
+
+import "fmt"
+
+// названия правил, которые возвращаются клиенту в Violation.Rule
+const (
+	RulePositiveSum   = "positive_sum"
+	RuleMinSum        = "min_sum"
+	RuleMaxSum        = "max_sum"
+	RuleDailyCap      = "daily_cap"
+	RuleMonthlyCap    = "monthly_cap"
+	RuleMaxOrderShare = "max_order_share"
+)
+
+// Rules — правила списания. Нулевое значение отключает соответствующее правило,
+// кроме требования положительной суммы, которое действует всегда.
+type Rules struct {
+	//минимальная и максимальная сумма одного списания
+	MinSum float64
+	MaxSum float64
+	//ограничения суммы списаний пользователя за календарные сутки и месяц
+	DailyCap   float64
+	MonthlyCap float64
+	//максимальная доля стоимости заказа в процентах, которую можно оплатить баллами
+	MaxOrderShare float64
+}
+
+// Request — проверяемое списание.
+type Request struct {
+	Sum float64
+	//стоимость заказа, 0 — не передана
+	OrderTotal float64
+	//сумма списаний пользователя за текущие сутки и месяц без учета этого
+	SpentToday     float64
+	SpentThisMonth float64
+}
+
+// Violation описывает нарушенное правило.
+type Violation struct {
+	Rule    string  `json:"rule"`
+	Limit   float64 `json:"limit"`
+	Actual  float64 `json:"actual"`
+	Message string  `json:"message"`
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// HasCaps сообщает, нужны ли для проверки суммы списаний за период.
+func (r Rules) HasCaps() bool {
+	return r.DailyCap > 0 || r.MonthlyCap > 0
+}
+
+// Check возвращает первое нарушенное правило или nil.
+func (r Rules) Check(req Request) *Violation {
+	if req.Sum <= 0 {
+		return &Violation{Rule: RulePositiveSum, Actual: req.Sum,
+			Message: "withdrawal sum must be positive"}
+	}
+	if r.MinSum > 0 && req.Sum < r.MinSum {
+		return &Violation{Rule: RuleMinSum, Limit: r.MinSum, Actual: req.Sum,
+			Message: fmt.Sprintf("withdrawal sum is less than %v", r.MinSum)}
+	}
+	if r.MaxSum > 0 && req.Sum > r.MaxSum {
+		return &Violation{Rule: RuleMaxSum, Limit: r.MaxSum, Actual: req.Sum,
+			Message: fmt.Sprintf("withdrawal sum is more than %v", r.MaxSum)}
+	}
+	if r.MaxOrderShare > 0 && req.OrderTotal > 0 {
+		share := req.Sum / req.OrderTotal * 100
+		if share > r.MaxOrderShare {
+			return &Violation{Rule: RuleMaxOrderShare, Limit: r.MaxOrderShare, Actual: share,
+				Message: fmt.Sprintf("points can pay at most %v%% of the order", r.MaxOrderShare)}
+		}
+	}
+	if r.DailyCap > 0 && req.SpentToday+req.Sum > r.DailyCap {
+		return &Violation{Rule: RuleDailyCap, Limit: r.DailyCap, Actual: req.SpentToday + req.Sum,
+			Message: fmt.Sprintf("daily withdrawal cap of %v exceeded", r.DailyCap)}
+	}
+	if r.MonthlyCap > 0 && req.SpentThisMonth+req.Sum > r.MonthlyCap {
+		return &Violation{Rule: RuleMonthlyCap, Limit: r.MonthlyCap, Actual: req.SpentThisMonth + req.Sum,
+			Message: fmt.Sprintf("monthly withdrawal cap of %v exceeded", r.MonthlyCap)}
+	}
+	return nil
+}
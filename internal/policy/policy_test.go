@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules_Check(t *testing.T) {
+	rules := Rules{MinSum: 10, MaxSum: 1000, DailyCap: 1500, MonthlyCap: 3000, MaxOrderShare: 50}
+	tests := []struct {
+		name         string
+		rules        Rules
+		req          Request
+		expectedRule string
+	}{
+		{
+			name:  "allowed",
+			rules: rules,
+			req:   Request{Sum: 100, OrderTotal: 400, SpentToday: 200, SpentThisMonth: 1000},
+		},
+		{
+			name:         "zero sum without rules",
+			req:          Request{Sum: 0},
+			expectedRule: RulePositiveSum,
+		},
+		{
+			name:         "negative sum",
+			rules:        rules,
+			req:          Request{Sum: -50},
+			expectedRule: RulePositiveSum,
+		},
+		{
+			name:         "below minimum",
+			rules:        rules,
+			req:          Request{Sum: 5},
+			expectedRule: RuleMinSum,
+		},
+		{
+			name:         "above maximum",
+			rules:        rules,
+			req:          Request{Sum: 1001},
+			expectedRule: RuleMaxSum,
+		},
+		{
+			name:         "too large share of the order",
+			rules:        rules,
+			req:          Request{Sum: 300, OrderTotal: 400},
+			expectedRule: RuleMaxOrderShare,
+		},
+		{
+			name:  "share is not checked without order total",
+			rules: rules,
+			req:   Request{Sum: 300},
+		},
+		{
+			name:         "daily cap",
+			rules:        rules,
+			req:          Request{Sum: 600, SpentToday: 1000},
+			expectedRule: RuleDailyCap,
+		},
+		{
+			name:         "monthly cap",
+			rules:        rules,
+			req:          Request{Sum: 600, SpentThisMonth: 2500},
+			expectedRule: RuleMonthlyCap,
+		},
+		{
+			name: "no limits",
+			req:  Request{Sum: 1e9, OrderTotal: 1, SpentToday: 1e9, SpentThisMonth: 1e9},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := tt.rules.Check(tt.req)
+			if tt.expectedRule == "" {
+				assert.Nil(t, v)
+				return
+			}
+			if assert.NotNil(t, v) {
+				assert.Equal(t, tt.expectedRule, v.Rule)
+				assert.NotEmpty(t, v.Error())
+			}
+		})
+	}
+}
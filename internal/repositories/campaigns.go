@@ -0,0 +1,222 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// CreateCampaign создает бонусную кампанию. Промокоды сравниваются без учета регистра.
+func (p *PGSStore) CreateCampaign(ctx context.Context, c *storage.Campaign) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.CreateCampaign")
+	defer span.End()
+	//проверка параметров кампании
+	c.Code = strings.ToUpper(strings.TrimSpace(c.Code))
+	if c.Code == "" {
+		return 400, fmt.Errorf("promo code is empty")
+	}
+	if c.Bonus <= 0 {
+		return 400, fmt.Errorf("bonus must be positive")
+	}
+	if c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt) {
+		return 400, fmt.Errorf("campaign ends before it starts")
+	}
+	if c.MaxRedemptions < 0 || c.PerUserLimit < 0 {
+		return 400, fmt.Errorf("redemption limits must not be negative")
+	}
+	//по умолчанию пользователь может погасить промокод один раз
+	if c.PerUserLimit == 0 {
+		c.PerUserLimit = 1
+	}
+	q := `INSERT INTO campaigns (code, bonus, starts_at, ends_at, max_redemptions, per_user_limit, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, current_timestamp) ON CONFLICT (code) DO NOTHING RETURNING id, created_at`
+	err := p.client.QueryRow(ctx, q, c.Code, c.Bonus, c.StartsAt, c.EndsAt, c.MaxRedemptions, c.PerUserLimit).
+		Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 409, fmt.Errorf("promo code %s already exists", c.Code)
+		}
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	return 201, nil
+}
+
+// GetCampaigns возвращает кампании со статистикой погашений.
+func (p *PGSStore) GetCampaigns(ctx context.Context) (int, []storage.Campaign, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetCampaigns")
+	defer span.End()
+	q := `SELECT c.id, c.code, c.bonus, c.starts_at, c.ends_at, c.max_redemptions, c.per_user_limit,
+			c.redemptions, COALESCE(SUM(r.bonus), 0), c.created_at
+		FROM campaigns c LEFT JOIN promo_redemptions r ON r.campaign_id = c.id
+		GROUP BY c.id ORDER BY c.id`
+	rows, err := p.replica.Query(ctx, q)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var campaigns []storage.Campaign
+	for rows.Next() {
+		var c storage.Campaign
+		err = rows.Scan(&c.ID, &c.Code, &c.Bonus, &c.StartsAt, &c.EndsAt, &c.MaxRedemptions, &c.PerUserLimit,
+			&c.Redemptions, &c.RedeemedPoints, &c.CreatedAt)
+		if err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if len(campaigns) == 0 {
+		return 204, nil, fmt.Errorf("no one campaign")
+	}
+	return 200, campaigns, nil
+}
+
+// GetCampaignRedemptions возвращает погашения промокода кампании.
+func (p *PGSStore) GetCampaignRedemptions(ctx context.Context, id int64) (int, []storage.PromoRedemption, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetCampaignRedemptions")
+	defer span.End()
+	var code string
+	q := `SELECT code FROM campaigns WHERE id = $1`
+	if err := p.replica.QueryRow(ctx, q, id).Scan(&code); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, nil, fmt.Errorf("campaign %d not found", id)
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	q = `SELECT user_id, bonus, created_at FROM promo_redemptions WHERE campaign_id = $1 ORDER BY id`
+	rows, err := p.replica.Query(ctx, q, id)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var redemptions []storage.PromoRedemption
+	for rows.Next() {
+		r := storage.PromoRedemption{CampaignID: id, Code: code}
+		if err = rows.Scan(&r.UserID, &r.Bonus, &r.CreatedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		redemptions = append(redemptions, r)
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if len(redemptions) == 0 {
+		return 204, nil, fmt.Errorf("no one redemption")
+	}
+	return 200, redemptions, nil
+}
+
+// RedeemPromo погашает промокод и зачисляет бонус на баланс пользователя в одной транзакции.
+func (p *PGSStore) RedeemPromo(ctx context.Context, login string, code string) (int, *storage.PromoRedemption, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.RedeemPromo", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return 400, nil, fmt.Errorf("promo code is empty")
+	}
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, nil, err
+	}
+	defer tx.Rollback(ctx)
+	//строка кампании блокируется, чтобы параллельные погашения не превысили лимиты
+	var c storage.Campaign
+	q := `SELECT id, bonus, starts_at, ends_at, max_redemptions, per_user_limit, redemptions
+		FROM campaigns WHERE code = $1 FOR UPDATE`
+	err = tx.QueryRow(ctx, q, code).
+		Scan(&c.ID, &c.Bonus, &c.StartsAt, &c.EndsAt, &c.MaxRedemptions, &c.PerUserLimit, &c.Redemptions)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, nil, fmt.Errorf("promo code %s not found", code)
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	now := time.Now()
+	if (c.StartsAt != nil && now.Before(*c.StartsAt)) || (c.EndsAt != nil && !now.Before(*c.EndsAt)) {
+		return 422, nil, fmt.Errorf("promo code %s is not active", code)
+	}
+	if c.MaxRedemptions > 0 && c.Redemptions >= c.MaxRedemptions {
+		return 409, nil, fmt.Errorf("promo code %s is exhausted", code)
+	}
+	var userID, used int
+	q = `SELECT u.id, (SELECT COUNT(*) FROM promo_redemptions r WHERE r.campaign_id = $2 AND r.user_id = u.id)
+		FROM users u WHERE u.login = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, login, c.ID).Scan(&userID, &used); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 500, nil, fmt.Errorf("no user")
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	if used >= c.PerUserLimit {
+		return 409, nil, fmt.Errorf("promo code %s already redeemed", code)
+	}
+	r := storage.PromoRedemption{CampaignID: c.ID, Code: code, UserID: userID, Bonus: c.Bonus}
+	q = `INSERT INTO promo_redemptions (campaign_id, user_id, bonus, created_at)
+		VALUES ($1, $2, $3, current_timestamp) RETURNING created_at`
+	if err = tx.QueryRow(ctx, q, c.ID, userID, c.Bonus).Scan(&r.CreatedAt); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return 500, nil, err
+	}
+	q = `UPDATE campaigns SET redemptions = redemptions + 1 WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, c.ID); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, nil, err
+	}
+	//бонус зачисляется отдельной партией баллов и не учитывается при расчете уровня лояльности
+	if err = addLot(ctx, tx, userID, storage.LedgerPromo, code, c.Bonus, p.pointsTTL); err != nil {
+		p.logger.LogErr(err, "failed to add points")
+		return 500, nil, err
+	}
+	if err = p.repayDebt(ctx, tx, userID); err != nil {
+		p.logger.LogErr(err, "failed to repay clawback debt")
+		return 500, nil, err
+	}
+	var balance storage.Balance
+	q = `UPDATE users SET balance_current = balance_current + $1 WHERE id = $2
+		RETURNING balance_current, balance_withdrawn`
+	if err = tx.QueryRow(ctx, q, c.Bonus, userID).Scan(&balance.Current, &balance.Withdrawn); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, nil, err
+	}
+	err = insertEvent(ctx, tx, events.TypeBalanceUpdated, strconv.Itoa(userID), events.BalanceUpdated{
+		UserID:    userID,
+		Accrued:   c.Bonus,
+		Current:   balance.Current,
+		Withdrawn: balance.Withdrawn,
+	})
+	if err != nil {
+		p.logger.LogErr(err, "failed to insert event")
+		return 500, nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, nil, err
+	}
+	return 200, &r, nil
+}
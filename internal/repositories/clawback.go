@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// OrderReversed — статус заказа, начисление по которому отменено после возврата товара.
+const OrderReversed = "REVERSED"
+
+// режимы отмены начисления, если баллы уже потрачены
+const (
+	// ClawbackNegative списывает всю сумму, и баланс может стать отрицательным.
+	ClawbackNegative = "negative"
+	// ClawbackBlock списывает только доступные баллы, остаток становится долгом,
+	// а списания и переводы блокируются до его погашения.
+	ClawbackBlock = "block"
+)
+
+// blockedByDebt сообщает, заблокированы ли списания пользователя с долгом debt.
+func (p *PGSStore) blockedByDebt(debt float64) bool {
+	return p.clawbackMode == ClawbackBlock && debt > pointsEpsilon
+}
+
+// repayDebt гасит долг за отмененные начисления из партий пользователя. Вызывается после
+// каждого зачисления баллов в той же транзакции; строка пользователя должна быть заблокирована.
+func (p *PGSStore) repayDebt(ctx context.Context, tx pgx.Tx, userID int) error {
+	var debt float64
+	q := `SELECT clawback_debt FROM users WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, q, userID).Scan(&debt); err != nil {
+		return err
+	}
+	if debt <= pointsEpsilon {
+		return nil
+	}
+	parts, err := consumeLots(ctx, tx, userID, debt, storage.LedgerClawback, "")
+	if err != nil {
+		return err
+	}
+	repaid := 0.0
+	for _, part := range parts {
+		repaid += part.amount
+	}
+	if repaid <= pointsEpsilon {
+		return nil
+	}
+	//в режиме negative баланс уже уменьшен на всю сумму при отмене начисления: списание
+	//из партий погашает записанный тогда непокрытый остаток, и баланс по журналу не меняется
+	q = `UPDATE users SET clawback_debt = clawback_debt - $1 WHERE id = $2`
+	if p.clawbackMode == ClawbackBlock {
+		q = `UPDATE users SET clawback_debt = clawback_debt - $1, balance_current = balance_current - $1 WHERE id = $2`
+	} else if err = insertLedger(ctx, tx, userID, storage.LedgerClawback, repaid, nil, ""); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, q, repaid, userID)
+	return err
+}
+
+// Clawback отменяет начисление по заказу c.Order: списывает начисленные по нему баллы
+// (с учетом множителя уровня), переводит заказ в REVERSED и записывает это в историю.
+// Если баллы уже потрачены, поведение определяет режим clawbackMode.
+func (p *PGSStore) Clawback(ctx context.Context, source string, c *storage.Clawback) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.Clawback", trace.WithAttributes(
+		attribute.String(tracing.AttrOrderNumber, c.Order),
+		attribute.String("source", source),
+	))
+	defer span.End()
+	if c.Order == "" {
+		return 400, fmt.Errorf("empty order number")
+	}
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	var userID int
+	var status string
+	var accrual float64
+	q := `SELECT user_id, status, COALESCE(accrual, 0) FROM orders WHERE number = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, c.Order).Scan(&userID, &status, &accrual); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, fmt.Errorf("order %s not found", c.Order)
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	if !validTransition(status, OrderReversed) {
+		return 409, fmt.Errorf("order %s in status %s can't be reversed", c.Order, status)
+	}
+	//строка пользователя блокируется до изменения партий и баланса
+	tier, _, err := userTier(ctx, tx, userID)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	//истекшие партии сгорают сразу, иначе их сумма ушла бы в долг и позже сгорела бы повторно
+	if _, err = p.expireLapsedLots(ctx, tx, userID, 0); err != nil {
+		p.logger.LogErr(err, "failed to expire points")
+		return 500, err
+	}
+	//зачисленная сумма берется из партий: она уже включает множитель уровня
+	q = `SELECT COALESCE(SUM(amount), 0) FROM point_lots WHERE user_id = $1 AND source = $2 AND reference = $3`
+	if err = tx.QueryRow(ctx, q, userID, storage.LedgerAccrual, c.Order).Scan(&c.Amount); err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	if c.Amount <= pointsEpsilon {
+		c.Amount = accrual
+	}
+	parts, err := consumeLots(ctx, tx, userID, c.Amount, storage.LedgerClawback, c.Order)
+	if err != nil {
+		p.logger.LogErr(err, "failed to consume points")
+		return 500, err
+	}
+	covered := 0.0
+	for _, part := range parts {
+		covered += part.amount
+	}
+	debt := c.Amount - covered
+	if debt < pointsEpsilon {
+		debt = 0
+	}
+	debit := c.Amount
+	if p.clawbackMode == ClawbackBlock {
+		debit = covered
+	} else if debt > 0 {
+		//непокрытая партиями часть уменьшает баланс и тоже попадает в журнал
+		if err = insertLedger(ctx, tx, userID, storage.LedgerClawback, -debt, nil, c.Order); err != nil {
+			p.logger.LogErr(err, "Failure to insert object into table")
+			return 500, err
+		}
+	}
+	q = `UPDATE users SET balance_current = balance_current - $1, clawback_debt = clawback_debt + $2
+		WHERE id = $3 RETURNING balance_current, clawback_debt`
+	if err = tx.QueryRow(ctx, q, debit, debt, userID).Scan(&c.Current, &c.Debt); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if _, err = tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE number = $2`, OrderReversed, c.Order); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if err = insertHistory(ctx, tx, userID, c.Order, status, OrderReversed, c.Amount, source); err != nil {
+		p.logger.LogErr(err, "failed to insert history")
+		return 500, err
+	}
+	err = insertEvent(ctx, tx, events.TypeOrderStatusChanged, c.Order, events.OrderStatusChanged{
+		UserID:    userID,
+		Order:     c.Order,
+		OldStatus: status,
+		Status:    OrderReversed,
+		Accrual:   accrual,
+	})
+	if err != nil {
+		p.logger.LogErr(err, "failed to insert event")
+		return 500, err
+	}
+	err = insertEvent(ctx, tx, events.TypeBalanceClawedBack, strconv.Itoa(userID), events.BalanceClawedBack{
+		UserID:  userID,
+		Order:   c.Order,
+		Amount:  c.Amount,
+		Current: c.Current,
+		Debt:    c.Debt,
+	})
+	if err != nil {
+		p.logger.LogErr(err, "failed to insert event")
+		return 500, err
+	}
+	//отмененное начисление больше не учитывается в уровне лояльности
+	if err = recalculateTier(ctx, tx, userID, tier); err != nil {
+		p.logger.LogErr(err, "failed to recalculate tier")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// статусы удержания баллов
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+	HoldExpired  = "EXPIRED"
+)
+
+// heldAmount возвращает сумму действующих удержаний пользователя.
+func heldAmount(ctx context.Context, tx pgx.Tx, userID int) (float64, error) {
+	var held float64
+	q := `SELECT COALESCE(SUM(amount), 0) FROM holds
+		WHERE user_id = $1 AND status = $2 AND expires_at > current_timestamp`
+	err := tx.QueryRow(ctx, q, userID, HoldActive).Scan(&held)
+	return held, err
+}
+
+// CreateHold резервирует h.Sum баллов под заказ h.Order на время holdTTL. Удержанные баллы
+// остаются на балансе, но недоступны для списаний и переводов.
+func (p *PGSStore) CreateHold(ctx context.Context, login string, h *storage.Hold) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.CreateHold", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.String(tracing.AttrOrderNumber, h.Order),
+	))
+	defer span.End()
+	if !p.Valid(h.Order) {
+		return 422, fmt.Errorf("wrong orders number %v", h.Order)
+	}
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	var u storage.User
+	q := `SELECT id, balance_current, clawback_debt FROM users WHERE login = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, login).Scan(&u.ID, &u.Accrual.Current, &u.Accrual.Debt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 500, fmt.Errorf("no user")
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	if p.blockedByDebt(u.Accrual.Debt) {
+		return 402, fmt.Errorf("withdrawals are blocked until clawback debt is repaid")
+	}
+	//истекшие баллы сгорают до проверки суммы, даже если их еще не обработал ExpirePoints
+	if u.Accrual.Current, err = p.expireLapsedLots(ctx, tx, u.ID, u.Accrual.Current); err != nil {
+		p.logger.LogErr(err, "failed to expire points")
+		return 500, err
+	}
+	var withdrawn bool
+	q = `SELECT EXISTS (SELECT 1 FROM balance_withdrawn WHERE orders = $1)`
+	if err = tx.QueryRow(ctx, q, h.Order).Scan(&withdrawn); err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	if withdrawn {
+		return 409, fmt.Errorf("order %s is already paid", h.Order)
+	}
+	if statusCode, err := p.checkWithdrawPolicy(ctx, tx, u.ID, h.Sum, h.Total); err != nil {
+		return statusCode, err
+	}
+	held, err := heldAmount(ctx, tx, u.ID)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	if h.Sum > u.Accrual.Current-held {
+		return 402, fmt.Errorf("insufficient funds")
+	}
+	//истекшее удержание того же заказа освобождает номер для нового
+	q = `UPDATE holds SET status = $2, finished_at = current_timestamp
+		WHERE order_number = $1 AND status = $3 AND expires_at <= current_timestamp`
+	if _, err = tx.Exec(ctx, q, h.Order, HoldExpired, HoldActive); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	h.Status = HoldActive
+	q = `INSERT INTO holds (user_id, order_number, amount, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, current_timestamp, current_timestamp + $5 * interval '1 millisecond')
+		ON CONFLICT (order_number) WHERE status = 'ACTIVE' DO NOTHING
+		RETURNING id, created_at, expires_at`
+	err = tx.QueryRow(ctx, q, u.ID, h.Order, h.Sum, h.Status, p.holdTTL.Milliseconds()).
+		Scan(&h.ID, &h.CreatedAt, &h.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 409, fmt.Errorf("order %s is already on hold", h.Order)
+		}
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 201, nil
+}
+
+// GetHolds возвращает удержания пользователя, новые — первыми. Истекшие, но еще не
+// снятые фоновой задачей удержания показываются как EXPIRED.
+func (p *PGSStore) GetHolds(ctx context.Context, login string) (int, []storage.Hold, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetHolds", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	q := `SELECT h.id, h.order_number, h.amount,
+			CASE WHEN h.status = $2 AND h.expires_at <= current_timestamp THEN $3 ELSE h.status END,
+			h.created_at, h.expires_at
+		FROM holds h JOIN users u ON u.id = h.user_id WHERE u.login = $1 ORDER BY h.id DESC`
+	rows, err := p.replica.Query(ctx, q, login, HoldActive, HoldExpired)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var holds []storage.Hold
+	for rows.Next() {
+		var h storage.Hold
+		if err = rows.Scan(&h.ID, &h.Order, &h.Sum, &h.Status, &h.CreatedAt, &h.ExpiresAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		holds = append(holds, h)
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if len(holds) == 0 {
+		return 204, nil, fmt.Errorf("no one hold")
+	}
+	return 200, holds, nil
+}
+
+// lockHold блокирует действующее удержание пользователя login: 404, если удержания нет,
+// 403, если оно чужое, и 409, если оно уже подтверждено, снято или истекло.
+func (p *PGSStore) lockHold(ctx context.Context, tx pgx.Tx, login string, id int64) (int, *storage.Hold, int, error) {
+	var h storage.Hold
+	var userID int
+	var owner string
+	var expired bool
+	q := `SELECT h.id, h.user_id, u.login, h.order_number, h.amount, h.status, h.created_at, h.expires_at,
+			h.expires_at <= current_timestamp
+		FROM holds h JOIN users u ON u.id = h.user_id WHERE h.id = $1 FOR UPDATE OF h`
+	err := tx.QueryRow(ctx, q, id).Scan(&h.ID, &userID, &owner, &h.Order, &h.Sum, &h.Status, &h.CreatedAt,
+		&h.ExpiresAt, &expired)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, nil, 0, fmt.Errorf("hold %d not found", id)
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, 0, err
+	}
+	if owner != login {
+		return 403, nil, 0, fmt.Errorf("hold %d belongs to another user", id)
+	}
+	if h.Status == HoldActive && expired {
+		h.Status = HoldExpired
+	}
+	if h.Status != HoldActive {
+		return 409, nil, 0, fmt.Errorf("hold %d is %s", id, h.Status)
+	}
+	return 200, &h, userID, nil
+}
+
+// CaptureHold подтверждает удержание: зарезервированные баллы списываются так же, как в Withdraw.
+func (p *PGSStore) CaptureHold(ctx context.Context, login string, id int64) (int, *storage.Hold, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.CaptureHold", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.Int64("hold.id", id),
+	))
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, nil, err
+	}
+	defer tx.Rollback(ctx)
+	statusCode, h, userID, err := p.lockHold(ctx, tx, login, id)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	var u storage.User
+	q := `SELECT id, balance_current, balance_withdrawn, clawback_debt FROM users WHERE id = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, userID).Scan(&u.ID, &u.Accrual.Current, &u.Accrual.Withdrawn, &u.Accrual.Debt); err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	if p.blockedByDebt(u.Accrual.Debt) {
+		return 402, nil, fmt.Errorf("withdrawals are blocked until clawback debt is repaid")
+	}
+	if u.Accrual.Current, err = p.expireLapsedLots(ctx, tx, u.ID, u.Accrual.Current); err != nil {
+		p.logger.LogErr(err, "failed to expire points")
+		return 500, nil, err
+	}
+	//баланс мог уменьшиться после удержания, например при сгорании или отмене начисления
+	if h.Sum > u.Accrual.Current+pointsEpsilon {
+		return 402, nil, fmt.Errorf("insufficient funds")
+	}
+	var withdrawn bool
+	q = `SELECT EXISTS (SELECT 1 FROM balance_withdrawn WHERE orders = $1)`
+	if err = tx.QueryRow(ctx, q, h.Order).Scan(&withdrawn); err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	if withdrawn {
+		return 409, nil, fmt.Errorf("order %s is already paid", h.Order)
+	}
+	h.Status = HoldCaptured
+	q = `UPDATE holds SET status = $1, finished_at = current_timestamp WHERE id = $2`
+	if _, err = tx.Exec(ctx, q, h.Status, h.ID); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, nil, err
+	}
+	if err = p.debit(ctx, tx, &u, &storage.Order{Order: h.Order, Sum: h.Sum}); err != nil {
+		return 500, nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, nil, err
+	}
+	return 200, h, nil
+}
+
+// ReleaseHold снимает удержание, и баллы снова становятся доступны.
+func (p *PGSStore) ReleaseHold(ctx context.Context, login string, id int64) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ReleaseHold", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.Int64("hold.id", id),
+	))
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	statusCode, h, _, err := p.lockHold(ctx, tx, login, id)
+	if err != nil {
+		return statusCode, err
+	}
+	q := `UPDATE holds SET status = $1, finished_at = current_timestamp WHERE id = $2`
+	if _, err = tx.Exec(ctx, q, HoldReleased, h.ID); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
+
+// ExpireHolds помечает истекшие удержания. Баллы по ним перестают резервироваться
+// сразу по истечении срока, задача только фиксирует статус.
+func (p *PGSStore) ExpireHolds(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ExpireHolds")
+	defer span.End()
+	q := `UPDATE holds SET status = $1, finished_at = current_timestamp
+		WHERE status = $2 AND expires_at <= current_timestamp`
+	tag, err := p.client.Exec(ctx, q, HoldExpired, HoldActive)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int64("holds.count", tag.RowsAffected()))
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// ImportProgress возвращает номер последней строки файла source, загруженной импортом;
+// 0 — файл еще не загружался.
+func (p *PGSStore) ImportProgress(ctx context.Context, source string) (int64, error) {
+	var line int64
+	err := p.client.QueryRow(ctx, `SELECT line FROM import_progress WHERE source = $1`, source).Scan(&line)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return line, err
+}
+
+// saveImportProgress запоминает последнюю обработанную строку файла в транзакции пакета,
+// поэтому прерванный импорт продолжается со следующего пакета.
+func saveImportProgress(ctx context.Context, tx pgx.Tx, source string, line int64) error {
+	q := `INSERT INTO import_progress (source, line, updated_at) VALUES ($1, $2, current_timestamp)
+		ON CONFLICT (source) DO UPDATE SET line = EXCLUDED.line, updated_at = EXCLUDED.updated_at`
+	_, err := tx.Exec(ctx, q, source, line)
+	return err
+}
+
+// ImportUsers загружает пакет пользователей через COPY во временную таблицу. Пользователи,
+// чей логин уже занят, возвращаются как отклоненные. Баланс зачисляется бессрочной партией,
+// line — последняя строка файла, вошедшая в пакет.
+func (p *PGSStore) ImportUsers(ctx context.Context, source string, line int64, users []storage.ImportUser) ([]storage.ImportRejection, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ImportUsers")
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	q := `CREATE TEMP TABLE import_users (
+			line BIGINT, login VARCHAR(200), hashed_password VARCHAR(200),
+			balance_current DOUBLE PRECISION, balance_withdrawn DOUBLE PRECISION
+		) ON COMMIT DROP`
+	if _, err = tx.Exec(ctx, q); err != nil {
+		p.logger.LogErr(err, "failed to create table")
+		return nil, err
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"import_users"},
+		[]string{"line", "login", "hashed_password", "balance_current", "balance_withdrawn"},
+		pgx.CopyFromSlice(len(users), func(i int) ([]interface{}, error) {
+			u := users[i]
+			return []interface{}{u.Line, u.Login, u.HashedPassword, u.Current, u.Withdrawn}, nil
+		}))
+	if err != nil {
+		p.logger.LogErr(err, "failed to copy objects into table")
+		return nil, err
+	}
+	q = `INSERT INTO users (login, hashed_password, balance_current, balance_withdrawn)
+		SELECT login, hashed_password, balance_current, balance_withdrawn FROM import_users ORDER BY line
+		ON CONFLICT (login) DO NOTHING RETURNING id, login`
+	rows, err := tx.Query(ctx, q)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return nil, err
+	}
+	var ids []int64
+	inserted := make(map[string]bool, len(users))
+	for rows.Next() {
+		var id int64
+		var login string
+		if err = rows.Scan(&id, &login); err != nil {
+			rows.Close()
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		ids = append(ids, id)
+		inserted[login] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return nil, err
+	}
+	//баланс переносится партиями баллов с записью в журнал, как при обычном зачислении
+	q = `WITH lots AS (
+			INSERT INTO point_lots (user_id, source, reference, amount, remaining, created_at)
+			SELECT u.id, $1, $2, s.balance_current, s.balance_current, current_timestamp
+			FROM import_users s JOIN users u ON u.login = s.login
+			WHERE u.id = ANY($3) AND s.balance_current > 0
+			RETURNING id, user_id, amount
+		)
+		INSERT INTO balance_ledger (user_id, kind, amount, lot_id, reference, created_at)
+		SELECT user_id, $1, amount, id, $2, current_timestamp FROM lots`
+	if _, err = tx.Exec(ctx, q, storage.LedgerImport, source, ids); err != nil {
+		p.logger.LogErr(err, "failed to add points")
+		return nil, err
+	}
+	if err = saveImportProgress(ctx, tx, source, line); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return nil, err
+	}
+	var rejected []storage.ImportRejection
+	for _, u := range users {
+		if !inserted[u.Login] {
+			rejected = append(rejected, storage.ImportRejection{Line: u.Line, Reason: "login already exists"})
+		}
+	}
+	return rejected, nil
+}
+
+// ImportOrders загружает пакет заказов через COPY во временную таблицу. Заказы неизвестных
+// пользователей и уже загруженные номера возвращаются как отклоненные. Незавершенные заказы
+// проверяются в системе начислений как обычно.
+func (p *PGSStore) ImportOrders(ctx context.Context, source string, line int64, orders []storage.ImportOrder) ([]storage.ImportRejection, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ImportOrders")
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	q := `CREATE TEMP TABLE import_orders (
+			line BIGINT, login VARCHAR(200), number VARCHAR(200), status VARCHAR(200),
+			accrual DOUBLE PRECISION, uploaded_at TIMESTAMPTZ
+		) ON COMMIT DROP`
+	if _, err = tx.Exec(ctx, q); err != nil {
+		p.logger.LogErr(err, "failed to create table")
+		return nil, err
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"import_orders"},
+		[]string{"line", "login", "number", "status", "accrual", "uploaded_at"},
+		pgx.CopyFromSlice(len(orders), func(i int) ([]interface{}, error) {
+			o := orders[i]
+			return []interface{}{o.Line, o.Login, o.Number, o.Status, o.Accrual, o.UploadedAt}, nil
+		}))
+	if err != nil {
+		p.logger.LogErr(err, "failed to copy objects into table")
+		return nil, err
+	}
+	q = `WITH inserted AS (
+			INSERT INTO orders (user_id, number, status, accrual, uploaded_at)
+			SELECT u.id, s.number, s.status, s.accrual, s.uploaded_at
+			FROM import_orders s JOIN users u ON u.login = s.login ORDER BY s.line
+			ON CONFLICT (number) DO NOTHING
+			RETURNING user_id, number, status, accrual, uploaded_at
+		), history AS (
+			INSERT INTO order_status_history (user_id, order_number, status, accrual, source, created_at)
+			SELECT user_id, number, status, accrual, $1, uploaded_at FROM inserted
+		)
+		SELECT s.line, u.id IS NULL FROM import_orders s LEFT JOIN users u ON u.login = s.login
+		WHERE s.number NOT IN (SELECT number FROM inserted) ORDER BY s.line`
+	rows, err := tx.Query(ctx, q, storage.SourceImport)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return nil, err
+	}
+	var rejected []storage.ImportRejection
+	for rows.Next() {
+		var r storage.ImportRejection
+		var unknownUser bool
+		if err = rows.Scan(&r.Line, &unknownUser); err != nil {
+			rows.Close()
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		r.Reason = "order already exists"
+		if unknownUser {
+			r.Reason = "unknown user"
+		}
+		rejected = append(rejected, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return nil, err
+	}
+	if err = saveImportProgress(ctx, tx, source, line); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return nil, err
+	}
+	return rejected, nil
+}
@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+const (
+	// OrderFailed — окончательный статус заказа, который система начислений так и не рассчитала.
+	OrderFailed = "FAILED"
+	// OrderCancelled — статус в истории заказа, отмененного пользователем; сам заказ удаляется.
+	OrderCancelled = "CANCELLED"
+)
+
+// ClaimOrders выдает экземпляру workerID до limit заказов, проверка которых назначена
+// на текущий момент, и закрепляет их за ним на время lease. Заказы, захваченные другими
+// экземплярами, пропускаются, а аренда, истекшая без освобождения (например, экземпляр упал),
+// позволяет забрать заказ повторно.
+func (p *PGSStore) ClaimOrders(ctx context.Context, workerID string, limit int, lease time.Duration) ([]storage.Orders, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ClaimOrders", trace.WithAttributes(
+		attribute.String("worker.id", workerID),
+	))
+	defer span.End()
+	q := `UPDATE orders SET lease_owner = $1, lease_expires_at = current_timestamp + $3 * interval '1 millisecond'
+		WHERE number IN (
+			SELECT number FROM orders
+			WHERE status IN ('NEW', 'REGISTERED', 'PROCESSING') AND next_check_at <= current_timestamp
+				AND (lease_expires_at IS NULL OR lease_expires_at <= current_timestamp)
+			ORDER BY next_check_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING user_id, number`
+	rows, err := p.client.Query(ctx, q, workerID, limit, lease.Milliseconds())
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return nil, err
+	}
+	defer rows.Close()
+	var orders []storage.Orders
+	for rows.Next() {
+		var o storage.Orders
+		if err = rows.Scan(&o.UserID, &o.Order); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("orders.count", len(orders)))
+	return orders, nil
+}
+
+// ReleaseOrders снимает аренду экземпляра workerID с перечисленных заказов,
+// а при пустом списке — со всех его заказов, например при остановке сервиса.
+func (p *PGSStore) ReleaseOrders(ctx context.Context, workerID string, numbers []string) error {
+	ctx, span := tracer.Start(ctx, "PGSStore.ReleaseOrders", trace.WithAttributes(
+		attribute.String("worker.id", workerID),
+		attribute.Int("orders.count", len(numbers)),
+	))
+	defer span.End()
+	q := `UPDATE orders SET lease_owner = NULL, lease_expires_at = NULL
+		WHERE lease_owner = $1 AND (cardinality($2::text[]) = 0 OR number = ANY($2))`
+	if numbers == nil {
+		numbers = []string{}
+	}
+	if _, err := p.client.Exec(ctx, q, workerID, numbers); err != nil {
+		p.logger.LogErr(err, "failed to release orders")
+		return err
+	}
+	return nil
+}
+
+// RescheduleOrders откладывает следующую проверку заказов, по которым система начислений
+// ответила, но окончательного статуса еще нет. Интервал растет вдвое с каждой попыткой:
+// от 5 секунд до часа. Показатель степени ограничен, иначе при большом числе попыток
+// интервал переполняется раньше, чем его ограничит LEAST.
+func (p *PGSStore) RescheduleOrders(ctx context.Context, numbers []string) error {
+	ctx, span := tracer.Start(ctx, "PGSStore.RescheduleOrders", trace.WithAttributes(
+		attribute.Int("orders.count", len(numbers)),
+	))
+	defer span.End()
+	if len(numbers) == 0 {
+		return nil
+	}
+	q := `UPDATE orders SET attempts = attempts + 1, last_checked_at = current_timestamp,
+			next_check_at = current_timestamp + LEAST(interval '1 hour', interval '5 seconds' * power(2, LEAST(attempts, 10)))
+		WHERE number = ANY($1) AND status IN ('NEW', 'REGISTERED', 'PROCESSING')`
+	if _, err := p.client.Exec(ctx, q, numbers); err != nil {
+		p.logger.LogErr(err, "failed to reschedule orders")
+		return err
+	}
+	return nil
+}
+
+// FailStaleOrders переводит в статус FAILED заказы, не получившие окончательного статуса
+// за maxAge с момента загрузки. Заказы, арендованные агентом, пропускаются: их результат
+// может прийти в текущем цикле. Возвращает число таких заказов.
+func (p *PGSStore) FailStaleOrders(ctx context.Context, maxAge time.Duration) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.FailStaleOrders")
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	q := `UPDATE orders o SET status = $2
+		FROM (
+			SELECT number, status FROM orders
+			WHERE status IN ('NEW', 'REGISTERED', 'PROCESSING')
+				AND uploaded_at < current_timestamp - $1 * interval '1 millisecond'
+				AND (lease_expires_at IS NULL OR lease_expires_at <= current_timestamp)
+			FOR UPDATE SKIP LOCKED
+		) old
+		WHERE o.number = old.number
+		RETURNING o.user_id, o.number, old.status`
+	rows, err := tx.Query(ctx, q, maxAge.Milliseconds(), OrderFailed)
+	if err != nil {
+		p.logger.LogErr(err, "failed transaction")
+		return 0, err
+	}
+	var failed []events.OrderStatusChanged
+	for rows.Next() {
+		e := events.OrderStatusChanged{Status: OrderFailed}
+		if err = rows.Scan(&e.UserID, &e.Order, &e.OldStatus); err != nil {
+			rows.Close()
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 0, err
+		}
+		failed = append(failed, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "failed transaction")
+		return 0, err
+	}
+	for _, e := range failed {
+		if err = insertHistory(ctx, tx, e.UserID, e.Order, e.OldStatus, e.Status, 0, storage.SourceSystem); err != nil {
+			p.logger.LogErr(err, "failed to insert history")
+			return 0, err
+		}
+		if err = insertEvent(ctx, tx, events.TypeOrderStatusChanged, e.Order, e); err != nil {
+			p.logger.LogErr(err, "failed to insert event")
+			return 0, err
+		}
+	}
+	span.SetAttributes(attribute.Int("orders.count", len(failed)))
+	return len(failed), tx.Commit(ctx)
+}
+
+// GetFailedOrders возвращает заказы в статусе FAILED для разбора поддержкой.
+func (p *PGSStore) GetFailedOrders(ctx context.Context) (int, []storage.Orders, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetFailedOrders")
+	defer span.End()
+	q := `SELECT user_id, number, status, uploaded_at, attempts, last_checked_at FROM orders
+		WHERE status = $1 ORDER BY uploaded_at`
+	rows, err := p.replica.Query(ctx, q, OrderFailed)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var orders []storage.Orders
+	for rows.Next() {
+		var o storage.Orders
+		if err = rows.Scan(&o.UserID, &o.Order, &o.Status, &o.UploadedAt, &o.Attempts, &o.LastCheckedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err = rows.Err(); err != nil {
+		return 500, nil, err
+	}
+	if len(orders) == 0 {
+		return 204, nil, nil
+	}
+	return 200, orders, nil
+}
@@ -0,0 +1,179 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// orderTransitions — допустимые переходы статусов заказа. INVALID, FAILED и REVERSED
+// окончательные, а из PROCESSED можно выйти только отменой начисления.
+var orderTransitions = map[string][]string{
+	"NEW":        {"REGISTERED", "PROCESSING", "PROCESSED", "INVALID", OrderFailed},
+	"REGISTERED": {"PROCESSING", "PROCESSED", "INVALID", OrderFailed},
+	"PROCESSING": {"PROCESSED", "INVALID", OrderFailed},
+	"PROCESSED":  {OrderReversed},
+}
+
+func validTransition(from, to string) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// insertHistory записывает смену статуса заказа в рамках транзакции, изменившей заказ.
+// Пустой oldStatus означает загрузку заказа.
+func insertHistory(ctx context.Context, tx pgx.Tx, userID interface{}, number, oldStatus, status string, accrual float64, source string) error {
+	var old *string
+	if oldStatus != "" {
+		old = &oldStatus
+	}
+	q := `INSERT INTO order_status_history (user_id, order_number, old_status, status, accrual, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, current_timestamp)`
+	_, err := tx.Exec(ctx, q, userID, number, old, status, accrual, source)
+	return err
+}
+
+// GetOrderDetail возвращает заказ пользователя с историей статусов и списаниями: 404, если заказа нет,
+// и 403, если его загрузил другой пользователь.
+func (p *PGSStore) GetOrderDetail(ctx context.Context, login string, number string) (int, *storage.OrderDetail, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetOrderDetail", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.String(tracing.AttrOrderNumber, number),
+	))
+	defer span.End()
+	var detail storage.OrderDetail
+	var owner string
+	q := `SELECT o.user_id, u.login, o.number, o.status, o.accrual, o.uploaded_at
+		FROM orders o JOIN users u ON u.id = o.user_id WHERE o.number = $1`
+	err := p.replica.QueryRow(ctx, q, number).Scan(&detail.UserID, &owner, &detail.Order, &detail.Status,
+		&detail.Accrual, &detail.UploadedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, nil, fmt.Errorf("order %s not found", number)
+		}
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if owner != login {
+		return 403, nil, fmt.Errorf("order %s belongs to another user", number)
+	}
+	//история заказа фильтруется по владельцу: номер мог принадлежать другому пользователю до отмены
+	q = `SELECT COALESCE(old_status, ''), status, accrual, source, created_at FROM order_status_history
+		WHERE order_number = $1 AND user_id = $2 ORDER BY id`
+	rows, err := p.replica.Query(ctx, q, number, detail.UserID)
+	if err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	detail.History = []storage.OrderStatusChange{}
+	for rows.Next() {
+		var c storage.OrderStatusChange
+		if err = rows.Scan(&c.OldStatus, &c.Status, &c.Accrual, &c.Source, &c.CreatedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		detail.History = append(detail.History, c)
+	}
+	if err = rows.Err(); err != nil {
+		return 500, nil, err
+	}
+	rows.Close()
+	//списания баллов, оформленные этим пользователем на тот же номер
+	q = `SELECT orders, sum, refunded, processed_at FROM balance_withdrawn WHERE orders = $1 AND user_id = $2`
+	rows, err = p.replica.Query(ctx, q, number, detail.UserID)
+	if err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	detail.Withdrawals = []storage.Order{}
+	for rows.Next() {
+		var w storage.Order
+		if err = rows.Scan(&w.Order, &w.Sum, &w.Refunded, &w.ProcessedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		detail.Withdrawals = append(detail.Withdrawals, w)
+	}
+	if err = rows.Err(); err != nil {
+		return 500, nil, err
+	}
+	//идентификатор пользователя нужен только для выборки истории
+	detail.UserID = 0
+	return 200, &detail, nil
+}
+
+// CancelOrder удаляет заказ, который пользователь загрузил по ошибке, пока он в статусе NEW
+// и еще ни разу не проверялся в системе начислений. Отмена записывается в историю, а номер
+// освобождается для повторной загрузки. Возвращает 404, если заказа нет, 403 для чужого заказа
+// и 409, если заказ уже ушел в обработку.
+func (p *PGSStore) CancelOrder(ctx context.Context, login string, number string) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.CancelOrder", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.String(tracing.AttrOrderNumber, number),
+	))
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	var userID int
+	var owner, status string
+	var attempts int
+	var leased bool
+	q := `SELECT o.user_id, u.login, o.status, o.attempts, COALESCE(o.lease_expires_at > current_timestamp, false)
+		FROM orders o JOIN users u ON u.id = o.user_id WHERE o.number = $1 FOR UPDATE OF o`
+	if err = tx.QueryRow(ctx, q, number).Scan(&userID, &owner, &status, &attempts, &leased); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, fmt.Errorf("order %s not found", number)
+		}
+		p.logger.LogErr(err, "")
+		return 500, err
+	}
+	if owner != login {
+		return 403, fmt.Errorf("order %s belongs to another user", number)
+	}
+	//заказ, который агент уже проверял или проверяет прямо сейчас, мог быть зарегистрирован
+	//в системе начислений, поэтому отменить его нельзя
+	if status != "NEW" || attempts > 0 || leased {
+		return 409, fmt.Errorf("order %s is already being processed", number)
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM orders WHERE number = $1`, number); err != nil {
+		p.logger.LogErr(err, "failed transaction")
+		return 500, err
+	}
+	if err = insertHistory(ctx, tx, userID, number, status, OrderCancelled, 0, storage.SourceUser); err != nil {
+		p.logger.LogErr(err, "failed to insert history")
+		return 500, err
+	}
+	err = insertEvent(ctx, tx, events.TypeOrderStatusChanged, number, events.OrderStatusChanged{
+		UserID:    userID,
+		Order:     number,
+		OldStatus: status,
+		Status:    OrderCancelled,
+	})
+	if err != nil {
+		p.logger.LogErr(err, "failed to insert event")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
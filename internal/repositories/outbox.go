@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+)
+
+// insertEvent добавляет событие в outbox в рамках транзакции, изменившей данные.
+func insertEvent(ctx context.Context, tx pgx.Tx, eventType, aggregateID string, payload interface{}) error {
+	e, err := events.NewEvent(eventType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+	q := `INSERT INTO outbox (event_type, event_version, aggregate_id, payload, created_at, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, $5)`
+	_, err = tx.Exec(ctx, q, e.Type, e.Version, e.AggregateID, e.Payload, e.OccurredAt)
+	return err
+}
+
+func (p *PGSStore) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]events.Event, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ClaimEvents")
+	defer span.End()
+	//выбор готовых к отправке событий с блокировкой, чтобы другие экземпляры их пропустили,
+	//и продление срока, до которого событие не будет выдано повторно
+	q := `UPDATE outbox SET next_attempt_at = current_timestamp + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND failed_at IS NULL AND next_attempt_at <= current_timestamp
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, event_version, aggregate_id, payload, created_at`
+	rows, err := p.client.Query(ctx, q, limit, lease.Milliseconds())
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return nil, err
+	}
+	defer rows.Close()
+	var result []events.Event
+	for rows.Next() {
+		var e events.Event
+		if err = rows.Scan(&e.ID, &e.Type, &e.Version, &e.AggregateID, &e.Payload, &e.OccurredAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	//RETURNING не гарантирует порядок, а потребители ждут события в порядке появления
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (p *PGSStore) MarkPublished(ctx context.Context, id int64) error {
+	q := `UPDATE outbox SET published_at = current_timestamp, last_error = NULL WHERE id = $1`
+	if _, err := p.client.Exec(ctx, q, id); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	return nil
+}
+
+func (p *PGSStore) MarkFailed(ctx context.Context, id int64, cause error, maxAttempts int) error {
+	//после maxAttempts попыток событие больше не выдается и ждет разбора,
+	//до этого задержка удваивается с каждой попыткой: 1с, 2с, 4с ... но не больше часа;
+	//показатель степени ограничен, чтобы интервал не переполнялся
+	q := `UPDATE outbox SET attempts = attempts + 1, last_error = $2,
+			failed_at = CASE WHEN attempts + 1 >= $3 THEN current_timestamp ELSE failed_at END,
+			next_attempt_at = current_timestamp + LEAST(interval '1 hour', interval '1 second' * power(2, LEAST(attempts, 12)))
+		WHERE id = $1`
+	if _, err := p.client.Exec(ctx, q, id, cause.Error(), maxAttempts); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	return nil
+}
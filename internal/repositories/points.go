@@ -0,0 +1,265 @@
+package repositories
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+const (
+	//погрешность сравнения сумм баллов, которые хранятся в DOUBLE PRECISION
+	pointsEpsilon = 1e-9
+	//число пользователей, чьи партии баллов сгорают за один запуск
+	expiryBatchSize = 1000
+)
+
+// addLot зачисляет партию баллов со сроком действия ttl (0 — бессрочно) и записывает это в журнал.
+// Если пользователя нет, возвращает pgx.ErrNoRows.
+func addLot(ctx context.Context, tx pgx.Tx, userID int, kind, reference string, amount float64, ttl time.Duration) error {
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+	return insertLot(ctx, tx, userID, kind, reference, amount, expiresAt)
+}
+
+// insertLot зачисляет партию баллов, которая сгорает в expiresAt (nil — бессрочно).
+func insertLot(ctx context.Context, tx pgx.Tx, userID int, kind, reference string, amount float64, expiresAt *time.Time) error {
+	var lotID int64
+	q := `INSERT INTO point_lots (user_id, source, reference, amount, remaining, created_at, expires_at)
+		SELECT id, $2, $3, $4, $4, current_timestamp, $5 FROM users WHERE id = $1 RETURNING id`
+	if err := tx.QueryRow(ctx, q, userID, kind, reference, amount, expiresAt).Scan(&lotID); err != nil {
+		return err
+	}
+	return insertLedger(ctx, tx, userID, kind, amount, &lotID, reference)
+}
+
+// lotPart — часть партии баллов, списанная consumeLots.
+type lotPart struct {
+	amount    float64
+	expiresAt *time.Time
+}
+
+// consumeLots списывает amount из партий пользователя в порядке FIFO: сначала те,
+// что сгорят раньше, бессрочные — в последнюю очередь. Истекшие партии не расходуются,
+// даже если ExpirePoints их еще не обработал. Возвращает списанные части партий.
+func consumeLots(ctx context.Context, tx pgx.Tx, userID int, amount float64, kind, reference string) ([]lotPart, error) {
+	q := `SELECT id, remaining, expires_at FROM point_lots
+		WHERE user_id = $1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > current_timestamp)
+		ORDER BY expires_at NULLS LAST, id FOR UPDATE`
+	rows, err := tx.Query(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	type lot struct {
+		id        int64
+		remaining float64
+		expiresAt *time.Time
+	}
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err = rows.Scan(&l.id, &l.remaining, &l.expiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	var parts []lotPart
+	left := amount
+	for _, l := range lots {
+		if left <= pointsEpsilon {
+			break
+		}
+		take := l.remaining
+		if take > left {
+			take = left
+		}
+		if _, err = tx.Exec(ctx, `UPDATE point_lots SET remaining = remaining - $1 WHERE id = $2`, take, l.id); err != nil {
+			return nil, err
+		}
+		lotID := l.id
+		if err = insertLedger(ctx, tx, userID, kind, -take, &lotID, reference); err != nil {
+			return nil, err
+		}
+		parts = append(parts, lotPart{amount: take, expiresAt: l.expiresAt})
+		left -= take
+	}
+	return parts, nil
+}
+
+func insertLedger(ctx context.Context, tx pgx.Tx, userID int, kind string, amount float64, lotID *int64, reference string) error {
+	q := `INSERT INTO balance_ledger (user_id, kind, amount, lot_id, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, current_timestamp)`
+	_, err := tx.Exec(ctx, q, userID, kind, amount, lotID, reference)
+	return err
+}
+
+// expiringSoon возвращает партии пользователя, которые сгорят в ближайшие window.
+func (p *PGSStore) expiringSoon(ctx context.Context, login string, window time.Duration) ([]storage.ExpiringPoints, error) {
+	q := `SELECT l.remaining, l.expires_at FROM point_lots l JOIN users u ON u.id = l.user_id
+		WHERE u.login = $1 AND l.remaining > 0 AND l.expires_at IS NOT NULL
+			AND l.expires_at <= current_timestamp + $2 * interval '1 millisecond'
+		ORDER BY l.expires_at`
+	rows, err := p.client.Query(ctx, q, login, window.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []storage.ExpiringPoints
+	for rows.Next() {
+		var e storage.ExpiringPoints
+		if err = rows.Scan(&e.Amount, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// ExpirePoints списывает остатки партий с истекшим сроком действия, уменьшает баланс
+// пользователей и пишет журнал и события. Строки пользователей блокируются раньше партий,
+// как во всех операциях с баллами, а занятые другими транзакциями пропускаются до следующего
+// запуска. При dryRun изменения откатываются, а отчет показывает, что сгорело бы.
+func (p *PGSStore) ExpirePoints(ctx context.Context, dryRun bool) ([]storage.PointsExpiry, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ExpirePoints", trace.WithAttributes(
+		attribute.Bool("dry_run", dryRun),
+	))
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	q := `SELECT id FROM users
+		WHERE id IN (SELECT user_id FROM point_lots WHERE remaining > 0 AND expires_at <= current_timestamp)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(ctx, q, expiryBatchSize)
+	if err != nil {
+		p.logger.LogErr(err, "failed transaction")
+		return nil, err
+	}
+	var users []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "failed transaction")
+		return nil, err
+	}
+
+	var report []storage.PointsExpiry
+	for _, userID := range users {
+		r, _, err := p.expireUserLots(ctx, tx, userID)
+		if err != nil {
+			p.logger.LogErr(err, "failed to expire points")
+			return nil, err
+		}
+		if r.Lots > 0 {
+			report = append(report, r)
+		}
+	}
+	span.SetAttributes(attribute.Int("users.count", len(report)))
+	if dryRun {
+		return report, nil
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return nil, err
+	}
+	return report, nil
+}
+
+// expireUserLots сжигает истекшие партии пользователя: обнуляет остатки, пишет журнал,
+// уменьшает баланс и добавляет событие points.expired. Возвращает сгоревшую сумму и баланс
+// после сгорания. Строка пользователя должна быть заблокирована.
+func (p *PGSStore) expireUserLots(ctx context.Context, tx pgx.Tx, userID int) (storage.PointsExpiry, storage.Balance, error) {
+	r := storage.PointsExpiry{UserID: userID}
+	var balance storage.Balance
+	q := `UPDATE point_lots l SET remaining = 0
+		FROM (
+			SELECT id, remaining FROM point_lots
+			WHERE user_id = $1 AND remaining > 0 AND expires_at <= current_timestamp
+			ORDER BY id
+			FOR UPDATE
+		) old
+		WHERE l.id = old.id
+		RETURNING l.id, old.remaining`
+	rows, err := tx.Query(ctx, q, userID)
+	if err != nil {
+		return r, balance, err
+	}
+	type expired struct {
+		lotID  int64
+		amount float64
+	}
+	var lots []expired
+	for rows.Next() {
+		var e expired
+		if err = rows.Scan(&e.lotID, &e.amount); err != nil {
+			rows.Close()
+			return r, balance, err
+		}
+		lots = append(lots, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return r, balance, err
+	}
+	for _, l := range lots {
+		lotID := l.lotID
+		if err = insertLedger(ctx, tx, userID, storage.LedgerExpiry, -l.amount, &lotID, ""); err != nil {
+			return r, balance, err
+		}
+		r.Amount += l.amount
+		r.Lots++
+	}
+	if r.Lots == 0 {
+		return r, balance, nil
+	}
+	q = `UPDATE users SET balance_current = GREATEST(balance_current - $1, 0) WHERE id = $2
+		RETURNING balance_current, balance_withdrawn`
+	if err = tx.QueryRow(ctx, q, r.Amount, userID).Scan(&balance.Current, &balance.Withdrawn); err != nil {
+		return r, balance, err
+	}
+	err = insertEvent(ctx, tx, events.TypePointsExpired, strconv.Itoa(userID), events.PointsExpired{
+		UserID:    userID,
+		Amount:    r.Amount,
+		Current:   balance.Current,
+		Withdrawn: balance.Withdrawn,
+	})
+	return r, balance, err
+}
+
+// expireLapsedLots сжигает партии пользователя, срок которых истек, но которые ExpirePoints
+// еще не обработал, и возвращает баланс после сгорания. Вызывается перед проверкой доступных
+// баллов в той же транзакции; строка пользователя должна быть заблокирована.
+func (p *PGSStore) expireLapsedLots(ctx context.Context, tx pgx.Tx, userID int, current float64) (float64, error) {
+	r, balance, err := p.expireUserLots(ctx, tx, userID)
+	if err != nil || r.Lots == 0 {
+		return current, err
+	}
+	return balance.Current, nil
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/policy"
+)
+
+// checkWithdrawPolicy проверяет списание sum по правилам withdrawPolicy и возвращает 422
+// с *policy.Violation, если правило нарушено. В лимиты за сутки и месяц входят списания
+// за вычетом возвратов и действующие удержания пользователя.
+func (p *PGSStore) checkWithdrawPolicy(ctx context.Context, tx pgx.Tx, userID int, sum, total float64) (int, error) {
+	req := policy.Request{Sum: sum, OrderTotal: total}
+	if p.withdrawPolicy.HasCaps() {
+		q := `SELECT
+				COALESCE((SELECT SUM(sum - refunded) FROM balance_withdrawn
+					WHERE user_id = $1 AND processed_at >= date_trunc('day', localtimestamp)), 0) +
+				COALESCE((SELECT SUM(amount) FROM holds
+					WHERE user_id = $1 AND status = $2 AND expires_at > current_timestamp
+					AND created_at >= date_trunc('day', current_timestamp)), 0),
+				COALESCE((SELECT SUM(sum - refunded) FROM balance_withdrawn
+					WHERE user_id = $1 AND processed_at >= date_trunc('month', localtimestamp)), 0) +
+				COALESCE((SELECT SUM(amount) FROM holds
+					WHERE user_id = $1 AND status = $2 AND expires_at > current_timestamp
+					AND created_at >= date_trunc('month', current_timestamp)), 0)`
+		if err := tx.QueryRow(ctx, q, userID, HoldActive).Scan(&req.SpentToday, &req.SpentThisMonth); err != nil {
+			p.logger.LogErr(err, "Failure to select object from table")
+			return 500, err
+		}
+	}
+	if v := p.withdrawPolicy.Check(req); v != nil {
+		return 422, v
+	}
+	return 0, nil
+}
@@ -6,22 +6,48 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/policy"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
 	"github.com/CyrilSbrodov/GopherAPIStore/pkg/client/postgresql"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
 )
 
+var tracer = otel.Tracer("github.com/CyrilSbrodov/GopherAPIStore/internal/repositories")
+
+// schemaVersion — версия схемы БД, которую ожидает код. Увеличивается при каждом изменении createTable.
+const schemaVersion = 17
+
 type PGSStore struct {
-	client postgresql.Client
-	logger loggers.Logger
+	client  postgresql.Client
+	replica postgresql.Client
+	logger  loggers.Logger
+	//срок действия начисленных баллов, 0 — бессрочно
+	pointsTTL time.Duration
+	//за сколько до сгорания баллы попадают в раздел «скоро сгорят» баланса
+	expiringSoonWindow time.Duration
+	//ограничения переводов баллов между пользователями
+	transferDailyLimit float64
+	transferMinBalance float64
+	//поведение при отмене начисления, если баллы уже потрачены
+	clawbackMode string
+	//время, через которое неподтвержденное удержание баллов снимается
+	holdTTL time.Duration
+	//правила списания баллов
+	withdrawPolicy policy.Rules
 }
 
 func createTable(ctx context.Context, client postgresql.Client, logger *loggers.Logger) error {
@@ -49,12 +75,193 @@ func createTable(ctx context.Context, client postgresql.Client, logger *loggers.
     		accrual DOUBLE PRECISION,
     		uploaded_at TIMESTAMPTZ(0) NOT NULL                             
 		);
+		ALTER TABLE orders ADD COLUMN if not exists attempts INT NOT NULL DEFAULT 0;
+		ALTER TABLE orders ADD COLUMN if not exists last_checked_at TIMESTAMPTZ;
+		ALTER TABLE orders ADD COLUMN if not exists next_check_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp;
+		ALTER TABLE orders ADD COLUMN if not exists lease_owner VARCHAR(200);
+		ALTER TABLE orders ADD COLUMN if not exists lease_expires_at TIMESTAMPTZ;
+		CREATE INDEX if not exists orders_next_check_index on orders (next_check_at)
+			WHERE status IN ('NEW', 'REGISTERED', 'PROCESSING');
 		CREATE TABLE if not exists balance_withdrawn (
     		user_id BIGINT,
     		FOREIGN KEY (user_id) REFERENCES users(id),
     		orders VARCHAR(200) PRIMARY KEY NOT NULL,
     		sum DOUBLE PRECISION NOT NULL,
 			processed_at TIMESTAMP(0) NOT NULL		                                  
+		);
+		CREATE TABLE if not exists outbox (
+			id BIGINT PRIMARY KEY generated always as identity,
+			event_type VARCHAR(200) NOT NULL,
+			event_version INT NOT NULL,
+			aggregate_id VARCHAR(200) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMPTZ NOT NULL,
+			last_error TEXT,
+			published_at TIMESTAMPTZ
+		);
+		CREATE INDEX if not exists outbox_pending_index on outbox (next_attempt_at) WHERE published_at IS NULL;
+		ALTER TABLE outbox ADD COLUMN if not exists failed_at TIMESTAMPTZ;
+		CREATE TABLE if not exists webhook_subscriptions (
+			id BIGINT PRIMARY KEY generated always as identity,
+			user_id BIGINT,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			url TEXT NOT NULL,
+			secret VARCHAR(200) NOT NULL,
+			event_types TEXT[] NOT NULL,
+			created_at TIMESTAMPTZ(0) NOT NULL
+		);
+		CREATE TABLE if not exists webhook_deliveries (
+			id BIGINT PRIMARY KEY generated always as identity,
+			subscription_id BIGINT NOT NULL,
+			FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+			event_id BIGINT NOT NULL,
+			event_type VARCHAR(200) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			response_code INT,
+			last_error TEXT,
+			next_attempt_at TIMESTAMPTZ NOT NULL,
+			delivered_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL,
+			UNIQUE (subscription_id, event_id)
+		);
+		CREATE INDEX if not exists webhook_deliveries_pending_index on webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+		CREATE TABLE if not exists order_status_history (
+			id BIGINT PRIMARY KEY generated always as identity,
+			user_id BIGINT,
+			order_number VARCHAR(200) NOT NULL,
+			old_status VARCHAR(200),
+			status VARCHAR(200) NOT NULL,
+			accrual DOUBLE PRECISION NOT NULL DEFAULT 0,
+			source VARCHAR(20) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX if not exists order_status_history_order_index on order_status_history (order_number);
+		INSERT INTO order_status_history (user_id, order_number, status, accrual, source, created_at)
+			SELECT o.user_id, o.number, o.status, COALESCE(o.accrual, 0), 'migration', o.uploaded_at FROM orders o
+			WHERE NOT EXISTS (SELECT 1 FROM order_status_history h WHERE h.order_number = o.number);
+		CREATE TABLE if not exists point_lots (
+			id BIGINT PRIMARY KEY generated always as identity,
+			user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			source VARCHAR(20) NOT NULL,
+			reference TEXT NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			remaining DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ
+		);
+		CREATE INDEX if not exists point_lots_user_index on point_lots (user_id) WHERE remaining > 0;
+		CREATE INDEX if not exists point_lots_expiry_index on point_lots (expires_at) WHERE remaining > 0;
+		CREATE TABLE if not exists balance_ledger (
+			id BIGINT PRIMARY KEY generated always as identity,
+			user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			kind VARCHAR(20) NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			lot_id BIGINT,
+			reference TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX if not exists balance_ledger_user_index on balance_ledger (user_id, id);
+		ALTER TABLE point_lots ALTER COLUMN reference TYPE TEXT;
+		ALTER TABLE balance_ledger ALTER COLUMN reference TYPE TEXT;
+		INSERT INTO point_lots (user_id, source, reference, amount, remaining, created_at)
+			SELECT u.id, 'migration', '', u.balance_current, u.balance_current, current_timestamp FROM users u
+			WHERE u.balance_current > 0 AND NOT EXISTS (SELECT 1 FROM point_lots l WHERE l.user_id = u.id);
+		INSERT INTO balance_ledger (user_id, kind, amount, lot_id, reference, created_at)
+			SELECT l.user_id, 'migration', l.amount, l.id, '', l.created_at FROM point_lots l
+			WHERE l.source = 'migration' AND NOT EXISTS (SELECT 1 FROM balance_ledger b WHERE b.lot_id = l.id AND b.amount > 0);
+		CREATE TABLE if not exists loyalty_tiers (
+			name VARCHAR(50) PRIMARY KEY,
+			min_points DOUBLE PRECISION NOT NULL UNIQUE,
+			multiplier DOUBLE PRECISION NOT NULL
+		);
+		INSERT INTO loyalty_tiers (name, min_points, multiplier) VALUES
+			('BASE', 0, 1), ('SILVER', 1000, 1.1), ('GOLD', 5000, 1.25), ('PLATINUM', 20000, 1.5)
+			ON CONFLICT DO NOTHING;
+		ALTER TABLE users ADD COLUMN if not exists tier VARCHAR(50) NOT NULL DEFAULT 'BASE';
+		CREATE TABLE if not exists tier_history (
+			id BIGINT PRIMARY KEY generated always as identity,
+			user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			old_tier VARCHAR(50) NOT NULL,
+			tier VARCHAR(50) NOT NULL,
+			rolling_points DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE if not exists campaigns (
+			id BIGINT PRIMARY KEY generated always as identity,
+			code VARCHAR(100) NOT NULL UNIQUE,
+			bonus DOUBLE PRECISION NOT NULL,
+			starts_at TIMESTAMPTZ,
+			ends_at TIMESTAMPTZ,
+			max_redemptions INTEGER NOT NULL DEFAULT 0,
+			per_user_limit INTEGER NOT NULL DEFAULT 1,
+			redemptions INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE if not exists promo_redemptions (
+			id BIGINT PRIMARY KEY generated always as identity,
+			campaign_id BIGINT NOT NULL,
+			FOREIGN KEY (campaign_id) REFERENCES campaigns(id),
+			user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			bonus DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX if not exists promo_redemptions_campaign_user_idx ON promo_redemptions (campaign_id, user_id);
+		CREATE TABLE if not exists transfers (
+			id BIGINT PRIMARY KEY generated always as identity,
+			sender_id BIGINT NOT NULL,
+			FOREIGN KEY (sender_id) REFERENCES users(id),
+			recipient_id BIGINT NOT NULL,
+			FOREIGN KEY (recipient_id) REFERENCES users(id),
+			amount DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX if not exists transfers_sender_idx ON transfers (sender_id, created_at);
+		CREATE INDEX if not exists transfers_recipient_idx ON transfers (recipient_id, created_at);
+		ALTER TABLE balance_withdrawn ADD COLUMN if not exists refunded DOUBLE PRECISION NOT NULL DEFAULT 0;
+		CREATE TABLE if not exists refunds (
+			id BIGINT PRIMARY KEY generated always as identity,
+			withdrawal VARCHAR(200) NOT NULL,
+			FOREIGN KEY (withdrawal) REFERENCES balance_withdrawn(orders),
+			user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			sum DOUBLE PRECISION NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			source VARCHAR(50) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX if not exists refunds_withdrawal_idx ON refunds (withdrawal);
+		ALTER TABLE users ADD COLUMN if not exists clawback_debt DOUBLE PRECISION NOT NULL DEFAULT 0;
+		CREATE TABLE if not exists holds (
+			id BIGINT PRIMARY KEY generated always as identity,
+			user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			order_number VARCHAR(200) NOT NULL,
+			amount DOUBLE PRECISION NOT NULL,
+			status VARCHAR(50) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			finished_at TIMESTAMPTZ
+		);
+		CREATE UNIQUE INDEX if not exists holds_active_order_uindex ON holds (order_number) WHERE status = 'ACTIVE';
+		CREATE INDEX if not exists holds_user_active_idx ON holds (user_id) WHERE status = 'ACTIVE';
+		CREATE TABLE if not exists import_progress (
+			source TEXT PRIMARY KEY,
+			line BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+		ALTER TABLE import_progress ALTER COLUMN source TYPE TEXT;
+		CREATE TABLE if not exists schema_migrations (
+			id INT PRIMARY KEY,
+			version INT NOT NULL,
+			applied_at TIMESTAMPTZ(0) NOT NULL
 		);`
 
 	_, err = tx.Exec(ctx, q)
@@ -62,41 +269,102 @@ func createTable(ctx context.Context, client postgresql.Client, logger *loggers.
 		logger.LogErr(err, "failed to create table")
 		return err
 	}
+	//фиксация версии схемы, до которой была доведена БД
+	q = `INSERT INTO schema_migrations (id, version, applied_at) VALUES (1, $1, current_timestamp)
+		ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version, applied_at = EXCLUDED.applied_at
+		WHERE schema_migrations.version < EXCLUDED.version`
+	if _, err = tx.Exec(ctx, q, schemaVersion); err != nil {
+		logger.LogErr(err, "failed to update schema version")
+		return err
+	}
 	return tx.Commit(ctx)
 }
 
 func NewPGSStore(client postgresql.Client, cfg *config.ServerConfig, logger *loggers.Logger) (*PGSStore, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	clawbackMode := cfg.ClawbackMode
+	if clawbackMode == "" {
+		clawbackMode = ClawbackNegative
+	}
+	if clawbackMode != ClawbackNegative && clawbackMode != ClawbackBlock {
+		return nil, fmt.Errorf("unknown clawback mode %s", cfg.ClawbackMode)
+	}
 	if err := createTable(ctx, client, logger); err != nil {
 		logger.LogErr(err, "failed to create table")
 		return nil, err
 	}
 	return &PGSStore{
-		client: client,
+		client:             client,
+		replica:            client,
+		logger:             *logger,
+		pointsTTL:          cfg.PointsTTL,
+		expiringSoonWindow: cfg.PointsExpiringSoon,
+		transferDailyLimit: cfg.TransferDailyLimit,
+		transferMinBalance: cfg.TransferMinBalance,
+		clawbackMode:       clawbackMode,
+		holdTTL:            cfg.HoldTTL,
+		withdrawPolicy: policy.Rules{
+			MinSum:        cfg.WithdrawMinSum,
+			MaxSum:        cfg.WithdrawMaxSum,
+			DailyCap:      cfg.WithdrawDailyCap,
+			MonthlyCap:    cfg.WithdrawMonthlyCap,
+			MaxOrderShare: cfg.WithdrawMaxOrderShare,
+		},
 	}, nil
 }
 
-func (p *PGSStore) Register(u *storage.AcceptUser) error {
+// UseReplica направляет запросы только на чтение (списки заказов и списаний) в реплику.
+func (p *PGSStore) UseReplica(replica postgresql.Client) {
+	if replica != nil {
+		p.replica = replica
+	}
+}
+
+// CheckMigrations проверяет, что схема БД не отстает от версии, которую ожидает код.
+func (p *PGSStore) CheckMigrations(ctx context.Context) error {
+	var version int
+	q := `SELECT version FROM schema_migrations WHERE id = 1`
+	if err := p.client.QueryRow(ctx, q).Scan(&version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("schema version is not set")
+		}
+		return err
+	}
+	if version < schemaVersion {
+		return fmt.Errorf("schema version %d is behind expected %d", version, schemaVersion)
+	}
+	return nil
+}
+
+func (p *PGSStore) Register(ctx context.Context, u *storage.AcceptUser) error {
+	ctx, span := tracer.Start(ctx, "PGSStore.Register", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, u.Login),
+	))
+	defer span.End()
 	//хэширование пароля
 	hashPassword := p.hashPassword(u.Password)
 	//добавление пользователя в базу
 	q := `INSERT INTO users (login, hashed_password, balance_current, balance_withdrawn)
 	   						VALUES ($1, $2, 0, 0)`
-	if _, err := p.client.Exec(context.Background(), q, u.Login, hashPassword); err != nil {
+	if _, err := p.client.Exec(ctx, q, u.Login, hashPassword); err != nil {
 		p.logger.LogErr(err, "Failure to insert object into table")
 		return err
 	}
 	return nil
 }
 
-func (p *PGSStore) Login(u *storage.AcceptUser) error {
+func (p *PGSStore) Login(ctx context.Context, u *storage.AcceptUser) error {
+	ctx, span := tracer.Start(ctx, "PGSStore.Login", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, u.Login),
+	))
+	defer span.End()
 	var password string
 	//хэширование полученного пароля
 	hashPassword := p.hashPassword(u.Password)
 	//получение хэш пароля, хранящегося в базе
 	q := `SELECT hashed_password FROM users WHERE login = $1`
-	if err := p.client.QueryRow(context.Background(), q, u.Login).Scan(&password); err != nil {
+	if err := p.client.QueryRow(ctx, q, u.Login).Scan(&password); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
 			return fmt.Errorf("wrong login %s", u.Login)
@@ -111,7 +379,12 @@ func (p *PGSStore) Login(u *storage.AcceptUser) error {
 	return nil
 }
 
-func (p *PGSStore) CollectOrder(login string, order string) (int, error) {
+func (p *PGSStore) CollectOrder(ctx context.Context, login string, order string) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.CollectOrder", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.String(tracing.AttrOrderNumber, order),
+	))
+	defer span.End()
 	//проверка номера ордера на валидность по алгоритсу Луны
 	if !p.Valid(order) {
 		return 422, fmt.Errorf("wrong orders number %v", order)
@@ -119,7 +392,7 @@ func (p *PGSStore) CollectOrder(login string, order string) (int, error) {
 	id := ""
 	//получаем id пользователя по логину
 	q := `SELECT users.id FROM users WHERE login = $1`
-	if err := p.client.QueryRow(context.Background(), q, login).Scan(&id); err != nil {
+	if err := p.client.QueryRow(ctx, q, login).Scan(&id); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
 			return 400, fmt.Errorf("wrong login %s", login)
@@ -130,14 +403,28 @@ func (p *PGSStore) CollectOrder(login string, order string) (int, error) {
 	userIDFromDB := ""
 	//проверка есть ли ордер в базе, если ордер есть, то получаем id того, кто его загрузил
 	q = `SELECT user_id FROM orders WHERE number = $1`
-	if err := p.client.QueryRow(context.Background(), q, order).Scan(&userIDFromDB); err != nil {
+	if err := p.client.QueryRow(ctx, q, order).Scan(&userIDFromDB); err != nil {
 		//если ордера нет, то заносим его в базу
 		if errors.Is(err, pgx.ErrNoRows) {
+			tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+			if err != nil {
+				p.logger.LogErr(err, "failed to begin transaction")
+				return 500, err
+			}
+			defer tx.Rollback(ctx)
 			q = `INSERT INTO orders (user_id, number, status, accrual, uploaded_at) VALUES ($1, $2, $3, $4, current_timestamp)`
-			if _, err := p.client.Exec(context.Background(), q, id, order, "NEW", 0); err != nil {
+			if _, err := tx.Exec(ctx, q, id, order, "NEW", 0); err != nil {
 				p.logger.LogErr(err, "Failure to insert object into table")
 				return 500, err
 			}
+			if err := insertHistory(ctx, tx, id, order, "", "NEW", 0, storage.SourceUser); err != nil {
+				p.logger.LogErr(err, "failed to insert history")
+				return 500, err
+			}
+			if err := tx.Commit(ctx); err != nil {
+				p.logger.LogErr(err, "failed to commit transaction")
+				return 500, err
+			}
 			//возвращаем 202 — новый номер заказа принят в обработку
 			return 202, nil
 		}
@@ -156,11 +443,15 @@ func (p *PGSStore) CollectOrder(login string, order string) (int, error) {
 	return 0, nil
 }
 
-func (p *PGSStore) GetOrder(login string) (int, []storage.Orders, error) {
+func (p *PGSStore) GetOrder(ctx context.Context, login string) (int, []storage.Orders, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetOrder", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
 	id := ""
 	//поиск id пользователя по логину
 	q := `SELECT users.id FROM users WHERE login = $1`
-	if err := p.client.QueryRow(context.Background(), q, login).Scan(&id); err != nil {
+	if err := p.replica.QueryRow(ctx, q, login).Scan(&id); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
 			return 204, nil, fmt.Errorf("wrong login %s", login)
@@ -172,7 +463,7 @@ func (p *PGSStore) GetOrder(login string) (int, []storage.Orders, error) {
 	var orders []storage.Orders
 	//получение списка ордеров по id пользователя
 	q = `SELECT number, status, accrual, uploaded_at FROM orders WHERE user_id = $1`
-	rows, err := p.client.Query(context.Background(), q, id)
+	rows, err := p.replica.Query(ctx, q, id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
@@ -194,103 +485,218 @@ func (p *PGSStore) GetOrder(login string) (int, []storage.Orders, error) {
 	return 200, orders, nil
 }
 
-func (p *PGSStore) GetBalance(login string) (*storage.Balance, error) {
+func (p *PGSStore) GetBalance(ctx context.Context, login string) (*storage.Balance, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetBalance", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
 	var balance storage.Balance
 
 	//получение баланса из базы по логину пользователя
-	q := `SELECT balance_current, balance_withdrawn FROM users WHERE login = $1`
-	if err := p.client.QueryRow(context.Background(), q, login).Scan(&balance.Current, &balance.Withdrawn); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			p.logger.LogErr(err, "Failure to select object from table")
-			return nil, fmt.Errorf("no balance")
-		}
-		p.logger.LogErr(err, "")
-		return nil, err
-	}
-
-	return &balance, nil
-}
-
-func (p *PGSStore) GetAllOrders() ([]storage.Orders, error) {
-
-	var orders []storage.Orders
-	//получение всех ордеров с нужным статусом
-	q := `SELECT user_id, number FROM orders WHERE status = 'REGISTERED' or status = 'PROCESSING' or status = 'NEW'`
-	rows, err := p.client.Query(context.Background(), q)
+	q := `SELECT balance_current, balance_withdrawn, tier, clawback_debt,
+			(SELECT COALESCE(SUM(amount), 0) FROM holds h
+				WHERE h.user_id = users.id AND h.status = $2 AND h.expires_at > current_timestamp)
+		FROM users WHERE login = $1`
+	err := p.client.QueryRow(ctx, q, login, HoldActive).
+		Scan(&balance.Current, &balance.Withdrawn, &balance.Tier, &balance.Debt, &balance.Held)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
-			return nil, fmt.Errorf("no one orders")
+			return nil, fmt.Errorf("no balance")
 		}
 		p.logger.LogErr(err, "")
 		return nil, err
 	}
-	//добавление всех ордеров в слайс
-	for rows.Next() {
-		var order storage.Orders
-		err = rows.Scan(&order.UserID, &order.Order)
+	if p.expiringSoonWindow > 0 {
+		expiring, err := p.expiringSoon(ctx, login, p.expiringSoonWindow)
 		if err != nil {
-			p.logger.LogErr(err, "Failure to scan object from table")
+			p.logger.LogErr(err, "")
 			return nil, err
 		}
-		orders = append(orders, order)
+		balance.ExpiringSoon = expiring
 	}
-	return orders, nil
+	balance.Available = balance.Current - balance.Held
+
+	return &balance, nil
 }
 
-func (p *PGSStore) UpdateOrders(orders []storage.Orders) error {
-	tx, err := p.client.BeginTx(context.Background(), pgx.TxOptions{})
+// UpdateOrders сохраняет ответы системы начислений, в той же транзакции зачисляет вознаграждение
+// по рассчитанным заказам и возвращает заказы, статус которых действительно изменился.
+// Недопустимые переходы (в том числе выход из окончательного статуса) пропускаются, поэтому
+// повторный ответ по тому же заказу, пришедший от другого экземпляра, не приведет к повторному
+// начислению. source записывается в историю статусов. Заказы и пользователи блокируются
+// в порядке номеров и идентификаторов, чтобы параллельные вызовы не взаимоблокировались.
+func (p *PGSStore) UpdateOrders(ctx context.Context, source string, orders []storage.Orders) ([]storage.Orders, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.UpdateOrders", trace.WithAttributes(
+		attribute.Int("orders.count", len(orders)),
+	))
+	defer span.End()
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		p.logger.LogErr(err, "failed to begin transaction")
-		return err
+		return nil, err
 	}
-	defer tx.Rollback(context.Background())
-	//обновление заказов пользователей
-	q := `UPDATE orders SET status = $1, accrual = $2 WHERE number = $3`
-	for _, o := range orders {
-		if _, err = tx.Exec(context.Background(), q, o.Status, o.Accrual, o.Order); err != nil {
+	defer tx.Rollback(ctx)
+	//копия, чтобы не менять порядок в срезе вызывающей стороны
+	sorted := make([]storage.Orders, len(orders))
+	copy(sorted, orders)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+	var changed []storage.Orders
+	for _, o := range sorted {
+		//блокировка заказа и получение его владельца и текущего статуса
+		var oldStatus string
+		q := `SELECT user_id, status FROM orders WHERE number = $1 FOR UPDATE`
+		if err = tx.QueryRow(ctx, q, o.Order).Scan(&o.UserID, &oldStatus); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			p.logger.LogErr(err, "failed transaction")
+			return nil, err
+		}
+		if !validTransition(oldStatus, o.Status) {
+			//окончательный ответ по заказу, уже признанному FAILED, не применяется автоматически,
+			//но не должен теряться: начисление разбирает поддержка
+			if oldStatus == OrderFailed && (o.Status == "PROCESSED" || o.Status == "INVALID") {
+				p.logger.LogErr(fmt.Errorf("order %s is %s, accrual %v", o.Order, o.Status, o.Accrual),
+					"accrual result arrived for a FAILED order")
+			}
+			continue
+		}
+		//обновление заказов пользователей
+		q = `UPDATE orders SET status = $1, accrual = $2 WHERE number = $3`
+		if _, err = tx.Exec(ctx, q, o.Status, o.Accrual, o.Order); err != nil {
 
 			p.logger.LogErr(err, "failed transaction")
-			return err
+			return nil, err
 		}
+		changed = append(changed, o)
+		if err = insertHistory(ctx, tx, o.UserID, o.Order, oldStatus, o.Status, o.Accrual, source); err != nil {
+			p.logger.LogErr(err, "failed to insert history")
+			return nil, err
+		}
+		//события о смене статуса пишутся в той же транзакции
+		err = insertEvent(ctx, tx, events.TypeOrderStatusChanged, o.Order, events.OrderStatusChanged{
+			UserID:    o.UserID,
+			Order:     o.Order,
+			OldStatus: oldStatus,
+			Status:    o.Status,
+			Accrual:   o.Accrual,
+		})
+		if err != nil {
+			p.logger.LogErr(err, "failed to insert event")
+			return nil, err
+		}
+		if o.Status == "PROCESSED" {
+			err = insertEvent(ctx, tx, events.TypeOrderProcessed, o.Order, events.OrderProcessed{
+				UserID:  o.UserID,
+				Order:   o.Order,
+				Status:  o.Status,
+				Accrual: o.Accrual,
+			})
+			if err != nil {
+				p.logger.LogErr(err, "failed to insert event")
+				return nil, err
+			}
+		}
+	}
+	if err = p.creditOrders(ctx, tx, changed); err != nil {
+		return nil, err
 	}
-	return tx.Commit(context.Background())
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return nil, err
+	}
+	return changed, nil
 }
 
-func (p *PGSStore) UpdateUserBalance(orders []storage.Orders) error {
-	//суммирование всех вознаграждений от заказов пользователя
-	ordersMap := make(map[int]float64)
+// creditOrders зачисляет вознаграждение по рассчитанным заказам в транзакции tx, в которой
+// меняется их статус, поэтому заказ не может остаться PROCESSED без начисления.
+func (p *PGSStore) creditOrders(ctx context.Context, tx pgx.Tx, orders []storage.Orders) error {
+	//группировка рассчитанных заказов по пользователям
+	ordersMap := make(map[int][]storage.Orders)
 	for _, o := range orders {
-		ordersMap[o.UserID] = o.Accrual
+		if o.Status != "PROCESSED" || o.Accrual == 0 {
+			continue
+		}
+		ordersMap[o.UserID] = append(ordersMap[o.UserID], o)
 	}
-	tx, err := p.client.BeginTx(context.Background(), pgx.TxOptions{})
-	if err != nil {
-		p.logger.LogErr(err, "failed to begin transaction")
-		return err
+	//обход карты случаен, а пользователей блокируем по возрастанию идентификатора
+	userIDs := make([]int, 0, len(ordersMap))
+	for id := range ordersMap {
+		userIDs = append(userIDs, id)
 	}
-	defer tx.Rollback(context.Background())
-	//обновление баланса пользователей
-	q := `UPDATE users SET balance_current = $1 WHERE id = $2`
-	for i, o := range ordersMap {
-		if _, err = tx.Exec(context.Background(), q, o, i); err != nil {
-
+	sort.Ints(userIDs)
+	q := `UPDATE users SET balance_current = balance_current + $1 WHERE id = $2
+		RETURNING balance_current, balance_withdrawn`
+	for _, i := range userIDs {
+		userOrders := ordersMap[i]
+		//уровень лояльности определяет множитель к сумме от системы начислений
+		tier, multiplier, err := userTier(ctx, tx, i)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
 			p.logger.LogErr(err, "failed transaction")
 			return err
 		}
+		//каждое начисление — отдельная партия баллов со своим сроком действия
+		var accrued float64
+		for _, o := range userOrders {
+			amount := o.Accrual * multiplier
+			if err = addLot(ctx, tx, i, storage.LedgerAccrual, o.Order, amount, p.pointsTTL); err != nil {
+				p.logger.LogErr(err, "failed to add points")
+				return err
+			}
+			accrued += amount
+		}
+		if err = p.repayDebt(ctx, tx, i); err != nil {
+			p.logger.LogErr(err, "failed to repay clawback debt")
+			return err
+		}
+		//начисление вознаграждения на баланс пользователя
+		var balance storage.Balance
+		if err = tx.QueryRow(ctx, q, accrued, i).Scan(&balance.Current, &balance.Withdrawn); err != nil {
+			p.logger.LogErr(err, "failed transaction")
+			return err
+		}
+		err = insertEvent(ctx, tx, events.TypeBalanceUpdated, strconv.Itoa(i), events.BalanceUpdated{
+			UserID:    i,
+			Accrued:   accrued,
+			Current:   balance.Current,
+			Withdrawn: balance.Withdrawn,
+		})
+		if err != nil {
+			p.logger.LogErr(err, "failed to insert event")
+			return err
+		}
+		if err = recalculateTier(ctx, tx, i, tier); err != nil {
+			p.logger.LogErr(err, "failed to recalculate tier")
+			return err
+		}
 	}
-
-	return tx.Commit(context.Background())
+	return nil
 }
 
-func (p *PGSStore) Withdraw(login string, order *storage.Order) (int, error) {
+func (p *PGSStore) Withdraw(ctx context.Context, login string, order *storage.Order) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.Withdraw", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+		attribute.String(tracing.AttrOrderNumber, order.Order),
+	))
+	defer span.End()
 	//проверка номера ордера на валидность по алгоритму Луны
 	if !p.Valid(order.Order) {
 		return 422, fmt.Errorf("wrong orders number %v", order.Order)
 	}
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
 	var u storage.User
-	//получение пользователя с балансом и id
-	q := `SELECT id, balance_current, balance_withdrawn FROM users WHERE login = $1`
-	if err := p.client.QueryRow(context.Background(), q, login).Scan(&u.ID, &u.Accrual.Current, &u.Accrual.Withdrawn); err != nil {
+	//получение пользователя с балансом и id, строка блокируется до конца транзакции
+	q := `SELECT id, balance_current, balance_withdrawn, clawback_debt FROM users WHERE login = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, q, login).Scan(&u.ID, &u.Accrual.Current, &u.Accrual.Withdrawn, &u.Accrual.Debt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
 			return 500, fmt.Errorf("no user")
@@ -298,34 +704,82 @@ func (p *PGSStore) Withdraw(login string, order *storage.Order) (int, error) {
 		p.logger.LogErr(err, "Failure to select object from table")
 		return 500, err
 	}
+	//пока не погашен долг за отмененные начисления, списания заблокированы
+	if p.blockedByDebt(u.Accrual.Debt) {
+		return 402, fmt.Errorf("withdrawals are blocked until clawback debt is repaid")
+	}
+	//истекшие баллы сгорают до проверки суммы, даже если их еще не обработал ExpirePoints
+	if u.Accrual.Current, err = p.expireLapsedLots(ctx, tx, u.ID, u.Accrual.Current); err != nil {
+		p.logger.LogErr(err, "failed to expire points")
+		return 500, err
+	}
+	if statusCode, err := p.checkWithdrawPolicy(ctx, tx, u.ID, order.Sum, order.Total); err != nil {
+		return statusCode, err
+	}
+	//удержанные баллы зарезервированы под другие заказы и недоступны для списания
+	held, err := heldAmount(ctx, tx, u.ID)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
 	//проверка, что суммы хватает на оплату заказа
-	if order.Sum > u.Accrual.Current {
+	if order.Sum > u.Accrual.Current-held {
 		//если суммы не хватает, то возвращаем 402 — на счету недостаточно средств
 		return 402, fmt.Errorf("insufficient funds")
-	} else {
-		u.Accrual.Current -= order.Sum
-		u.Accrual.Withdrawn += order.Sum
 	}
+	if err = p.debit(ctx, tx, &u, order); err != nil {
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
+
+// debit списывает order.Sum с баланса заблокированного пользователя u и оформляет списание.
+func (p *PGSStore) debit(ctx context.Context, tx pgx.Tx, u *storage.User, order *storage.Order) error {
+	u.Accrual.Current -= order.Sum
+	u.Accrual.Withdrawn += order.Sum
 	//обновление таблицы списаний
-	q = `INSERT INTO balance_withdrawn (user_id, orders, sum, processed_at) VALUES ($1, $2, $3, current_timestamp)`
-	if _, err := p.client.Exec(context.Background(), q, u.ID, order.Order, order.Sum); err != nil {
+	q := `INSERT INTO balance_withdrawn (user_id, orders, sum, processed_at) VALUES ($1, $2, $3, current_timestamp)`
+	if _, err := tx.Exec(ctx, q, u.ID, order.Order, order.Sum); err != nil {
 		p.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+		return err
+	}
+	//списание из партий баллов, начиная с тех, что сгорят раньше
+	if _, err := consumeLots(ctx, tx, u.ID, order.Sum, storage.LedgerWithdrawal, order.Order); err != nil {
+		p.logger.LogErr(err, "failed to consume points")
+		return err
 	}
 	//обновление пользователя с новым балансом
 	q = `UPDATE users SET balance_current = $1, balance_withdrawn = $2 WHERE id = $3`
-	if _, err := p.client.Exec(context.Background(), q, u.Accrual.Current, u.Accrual.Withdrawn, u.ID); err != nil {
+	if _, err := tx.Exec(ctx, q, u.Accrual.Current, u.Accrual.Withdrawn, u.ID); err != nil {
 		p.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+		return err
 	}
-	return 200, nil
+	//событие о списании пишется в той же транзакции
+	err := insertEvent(ctx, tx, events.TypeBalanceWithdrawn, order.Order, events.BalanceWithdrawn{
+		UserID: u.ID,
+		Order:  order.Order,
+		Sum:    order.Sum,
+	})
+	if err != nil {
+		p.logger.LogErr(err, "failed to insert event")
+		return err
+	}
+	return nil
 }
 
-func (p *PGSStore) Withdrawals(login string) (int, []storage.Order, error) {
+func (p *PGSStore) Withdrawals(ctx context.Context, login string) (int, []storage.Order, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.Withdrawals", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
 	id := ""
 	//поиск id пользователя по логину
 	q := `SELECT users.id FROM users WHERE login = $1`
-	if err := p.client.QueryRow(context.Background(), q, login).Scan(&id); err != nil {
+	if err := p.replica.QueryRow(ctx, q, login).Scan(&id); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
 			return 204, nil, fmt.Errorf("wrong login %s", login)
@@ -336,8 +790,8 @@ func (p *PGSStore) Withdrawals(login string) (int, []storage.Order, error) {
 
 	var orders []storage.Order
 	//получение спискок выводов средств по id пользователя
-	q = `SELECT orders, sum, processed_at FROM balance_withdrawn WHERE user_id = $1`
-	rows, err := p.client.Query(context.Background(), q, id)
+	q = `SELECT orders, sum, refunded, processed_at FROM balance_withdrawn WHERE user_id = $1`
+	rows, err := p.replica.Query(ctx, q, id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			p.logger.LogErr(err, "Failure to select object from table")
@@ -349,7 +803,7 @@ func (p *PGSStore) Withdrawals(login string) (int, []storage.Order, error) {
 	//добавление всех выводов средств в слайс
 	for rows.Next() {
 		var order storage.Order
-		err = rows.Scan(&order.Order, &order.Sum, &order.ProcessedAt)
+		err = rows.Scan(&order.Order, &order.Sum, &order.Refunded, &order.ProcessedAt)
 		if err != nil {
 			p.logger.LogErr(err, "Failure to scan object from table")
 			return 500, nil, err
@@ -359,6 +813,24 @@ func (p *PGSStore) Withdrawals(login string) (int, []storage.Order, error) {
 	return 200, orders, nil
 }
 
+func (p *PGSStore) GetUserID(ctx context.Context, login string) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetUserID", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	var id int
+	q := `SELECT users.id FROM users WHERE login = $1`
+	if err := p.client.QueryRow(ctx, q, login).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			p.logger.LogErr(err, "Failure to select object from table")
+			return 0, fmt.Errorf("wrong login %s", login)
+		}
+		p.logger.LogErr(err, "")
+		return 0, err
+	}
+	return id, nil
+}
+
 func (p *PGSStore) hashPassword(pass string) string {
 	h := hmac.New(sha256.New, []byte("password"))
 	h.Write([]byte(pass))
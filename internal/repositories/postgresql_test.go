@@ -1,12 +1,18 @@
 package repositories
 
 import (
+	"context"
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/config"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/policy"
 	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
 )
 
@@ -24,7 +30,7 @@ func TestPGSStore_Register(t *testing.T) {
 	s, teardown := TestPGStore(t, CFG)
 	defer teardown("users", "orders", "balance_withdrawn")
 
-	err := s.Register(&storage.AcceptUser{
+	err := s.Register(context.Background(), &storage.AcceptUser{
 		Login:    "test",
 		Password: "123456",
 	})
@@ -37,15 +43,15 @@ func TestPGSStore_CollectOrder(t *testing.T) {
 
 	login := "test"
 	order := "12345678903"
-	_, err := s.CollectOrder(login, order)
+	_, err := s.CollectOrder(context.Background(), login, order)
 	assert.Error(t, err)
 
-	err = s.Register(&storage.AcceptUser{
+	err = s.Register(context.Background(), &storage.AcceptUser{
 		Login:    "test",
 		Password: "123456",
 	})
 	assert.NoError(t, err)
-	_, err = s.CollectOrder(login, order)
+	_, err = s.CollectOrder(context.Background(), login, order)
 	assert.NoError(t, err)
 }
 
@@ -56,11 +62,11 @@ func TestPGSStore_Login(t *testing.T) {
 		Login:    "test",
 		Password: "123456",
 	}
-	err := s.Login(&u)
+	err := s.Login(context.Background(), &u)
 	assert.Error(t, err)
-	err = s.Register(&u)
+	err = s.Register(context.Background(), &u)
 	assert.NoError(t, err)
-	err = s.Login(&u)
+	err = s.Login(context.Background(), &u)
 	assert.NoError(t, err)
 }
 
@@ -73,26 +79,26 @@ func TestStoreGopher_GetOrder(t *testing.T) {
 	}
 	order := "12345678903"
 	// error no rows
-	statusCode, orders, err := s.GetOrder(u.Login)
+	statusCode, orders, err := s.GetOrder(context.Background(), u.Login)
 	assert.Error(t, err)
 	assert.NotNil(t, statusCode)
 	assert.Nil(t, orders)
 
 	// add user and orders
-	err = s.Register(&u)
+	err = s.Register(context.Background(), &u)
 	assert.NoError(t, err)
-	statusCode, err = s.CollectOrder(u.Login, order)
+	statusCode, err = s.CollectOrder(context.Background(), u.Login, order)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
 
 	//check orders
-	statusCode, orders, err = s.GetOrder(u.Login)
+	statusCode, orders, err = s.GetOrder(context.Background(), u.Login)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
 	assert.NotNil(t, orders)
 }
 
-func TestPGSStore_GetAllOrders(t *testing.T) {
+func TestPGSStore_ClaimOrdersPending(t *testing.T) {
 	s, teardown := TestPGStore(t, CFG)
 	defer teardown("users", "orders", "balance_withdrawn")
 	var u = storage.AcceptUser{
@@ -102,22 +108,22 @@ func TestPGSStore_GetAllOrders(t *testing.T) {
 	orderFirst := "12345678903"
 	orderSecond := "12345678911"
 
-	orders, err := s.GetAllOrders()
+	orders, err := s.ClaimOrders(context.Background(), "test", 10, time.Minute)
 	assert.Nil(t, orders)
 	assert.NoError(t, err)
 
 	// add user and orders
-	err = s.Register(&u)
+	err = s.Register(context.Background(), &u)
 	assert.NoError(t, err)
-	statusCode, err := s.CollectOrder(u.Login, orderFirst)
+	statusCode, err := s.CollectOrder(context.Background(), u.Login, orderFirst)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
-	statusCode, err = s.CollectOrder(u.Login, orderSecond)
+	statusCode, err = s.CollectOrder(context.Background(), u.Login, orderSecond)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
 
-	orders, err = s.GetAllOrders()
-	assert.NotNil(t, orders)
+	orders, err = s.ClaimOrders(context.Background(), "test", 10, time.Minute)
+	assert.Len(t, orders, 2)
 	assert.NoError(t, err)
 
 }
@@ -131,14 +137,14 @@ func TestPGSStore_GetBalance(t *testing.T) {
 	}
 	order := "12345678903"
 
-	balance, err := s.GetBalance(u.Login)
+	balance, err := s.GetBalance(context.Background(), u.Login)
 	assert.Error(t, err)
 	assert.Nil(t, balance)
 
-	err = s.Register(&u)
+	err = s.Register(context.Background(), &u)
 	assert.NoError(t, err)
 
-	statusCode, err := s.CollectOrder(u.Login, order)
+	statusCode, err := s.CollectOrder(context.Background(), u.Login, order)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
 
@@ -152,10 +158,10 @@ func TestPGSStore_GetBalance(t *testing.T) {
 		},
 	}
 
-	err = s.UpdateOrders(newOrders)
+	_, err = s.UpdateOrders(context.Background(), storage.SourceAgent, newOrders)
 	assert.NoError(t, err)
 
-	balance, err = s.GetBalance(u.Login)
+	balance, err = s.GetBalance(context.Background(), u.Login)
 	assert.NoError(t, err)
 	assert.NotNil(t, balance)
 
@@ -171,10 +177,10 @@ func TestPGSStore_UpdateOrders(t *testing.T) {
 	}
 	order := "12345678903"
 
-	err := s.Register(&u)
+	err := s.Register(context.Background(), &u)
 	assert.NoError(t, err)
 
-	statusCode, err := s.CollectOrder(u.Login, order)
+	statusCode, err := s.CollectOrder(context.Background(), u.Login, order)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
 
@@ -188,7 +194,7 @@ func TestPGSStore_UpdateOrders(t *testing.T) {
 		},
 	}
 
-	err = s.UpdateOrders(newOrders)
+	_, err = s.UpdateOrders(context.Background(), storage.SourceAgent, newOrders)
 	assert.NoError(t, err)
 }
 
@@ -217,9 +223,9 @@ func TestPGSStore_Valid(t *testing.T) {
 	}
 }
 
-func TestPGSStore_UpdateUserBalance(t *testing.T) {
+func TestPGSStore_UpdateOrdersCredit(t *testing.T) {
 	s, teardown := TestPGStore(t, CFG)
-	defer teardown("users", "orders", "balance_withdrawn")
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "tier_history")
 
 	var u = storage.AcceptUser{
 		Login:    "test",
@@ -227,23 +233,1069 @@ func TestPGSStore_UpdateUserBalance(t *testing.T) {
 	}
 	order := "12345678903"
 
-	err := s.Register(&u)
+	err := s.Register(context.Background(), &u)
 	assert.NoError(t, err)
 
-	statusCode, err := s.CollectOrder(u.Login, order)
+	statusCode, err := s.CollectOrder(context.Background(), u.Login, order)
 	assert.NoError(t, err)
 	assert.NotNil(t, statusCode)
 
 	var newOrders = []storage.Orders{
 		{
-			UserID:  0,
 			Order:   "12345678903",
 			Status:  "PROCESSED",
 			Accrual: 500,
-			Sum:     0,
 		},
 	}
 
-	err = s.UpdateUserBalance(newOrders)
+	//вознаграждение зачисляется в транзакции смены статуса
+	changed, err := s.UpdateOrders(context.Background(), storage.SourceAgent, newOrders)
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	balance, err := s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 500.0, balance.Current)
+
+	//повторный ответ не меняет статус и не начисляет баллы второй раз
+	changed, err = s.UpdateOrders(context.Background(), storage.SourceAgent, newOrders)
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+	balance, err = s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 500.0, balance.Current)
+}
+
+func TestPGSStore_ClaimEvents(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	order := "12345678903"
+
+	err := s.Register(context.Background(), &u)
+	assert.NoError(t, err)
+	_, err = s.CollectOrder(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+
+	_, err = s.UpdateOrders(context.Background(), storage.SourceAgent, []storage.Orders{
+		{
+			Order:   order,
+			Status:  "PROCESSED",
+			Accrual: 500,
+		},
+	})
+	assert.NoError(t, err)
+	//повторное обновление того же статуса не порождает событие
+	_, err = s.UpdateOrders(context.Background(), storage.SourceAgent, []storage.Orders{
+		{
+			Order:   order,
+			Status:  "PROCESSED",
+			Accrual: 500,
+		},
+	})
+	assert.NoError(t, err)
+
+	claimed, err := s.ClaimEvents(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	if assert.Len(t, claimed, 2) {
+		assert.Equal(t, events.TypeOrderStatusChanged, claimed[0].Type)
+		assert.Equal(t, events.TypeOrderProcessed, claimed[1].Type)
+		assert.Equal(t, order, claimed[1].AggregateID)
+	}
+
+	//забранное событие не выдается повторно до истечения lease
+	again, err := s.ClaimEvents(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, again)
+
+	assert.NoError(t, s.MarkPublished(context.Background(), claimed[0].ID))
+
+	//после многих попыток задержка не переполняется, а на последней событие больше не выдается
+	_, err = s.client.Exec(context.Background(), `UPDATE outbox SET attempts = 100 WHERE id = $1`, claimed[1].ID)
+	assert.NoError(t, err)
+	assert.NoError(t, s.MarkFailed(context.Background(), claimed[1].ID, errors.New("handler failed"), 200))
+	_, err = s.client.Exec(context.Background(), `UPDATE outbox SET next_attempt_at = current_timestamp WHERE id = $1`, claimed[1].ID)
+	assert.NoError(t, err)
+	again, err = s.ClaimEvents(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, again, 1)
+	assert.NoError(t, s.MarkFailed(context.Background(), claimed[1].ID, errors.New("handler failed"), 102))
+	_, err = s.client.Exec(context.Background(), `UPDATE outbox SET next_attempt_at = current_timestamp WHERE id = $1`, claimed[1].ID)
+	assert.NoError(t, err)
+	again, err = s.ClaimEvents(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, again)
+}
+
+func TestPGSStore_Webhooks(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "webhook_subscriptions", "webhook_deliveries")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	err := s.Register(context.Background(), &u)
+	assert.NoError(t, err)
+
+	statusCode, err := s.CreateWebhook(context.Background(), u.Login, &storage.WebhookSubscription{
+		URL:        "ftp://example.com",
+		EventTypes: []string{events.TypeOrderProcessed},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 400, statusCode)
+
+	//адрес во внутренней сети не принимается
+	statusCode, err = s.CreateWebhook(context.Background(), u.Login, &storage.WebhookSubscription{
+		URL:        "http://169.254.169.254/latest/meta-data",
+		EventTypes: []string{events.TypeOrderProcessed},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 400, statusCode)
+
+	w := storage.WebhookSubscription{
+		URL:        "https://203.0.113.10/hook",
+		EventTypes: []string{events.TypeOrderProcessed},
+	}
+	statusCode, err = s.CreateWebhook(context.Background(), u.Login, &w)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, statusCode)
+	assert.NotEmpty(t, w.Secret)
+
+	e, err := events.NewEvent(events.TypeOrderProcessed, "12345678903", events.OrderProcessed{Order: "12345678903"})
+	assert.NoError(t, err)
+	e.ID = 1
+	//повторная постановка того же события не создает дублей
+	assert.NoError(t, s.EnqueueWebhookDeliveries(context.Background(), e))
+	assert.NoError(t, s.EnqueueWebhookDeliveries(context.Background(), e))
+
+	deliveries, err := s.ClaimWebhookDeliveries(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, w.URL, deliveries[0].URL)
+		assert.NoError(t, s.CompleteWebhookDelivery(context.Background(), deliveries[0].ID, 200))
+	}
+
+	statusCode, log, err := s.GetWebhookDeliveries(context.Background(), u.Login, w.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, statusCode)
+	assert.Len(t, log, 1)
+
+	statusCode, err = s.ReplayWebhookDelivery(context.Background(), u.Login, log[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, statusCode)
+
+	statusCode, err = s.DeleteWebhook(context.Background(), u.Login, w.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, statusCode)
+}
+
+func TestPGSStore_RescheduleOrdersBackoff(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox")
+
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "test", Password: "123456"}))
+	order := "12345678903"
+	_, err := s.CollectOrder(context.Background(), "test", order)
+	assert.NoError(t, err)
+	//после многих попыток интервал не переполняется и ограничен часом
+	_, err = s.client.Exec(context.Background(), `UPDATE orders SET attempts = 100 WHERE number = $1`, order)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.RescheduleOrders(context.Background(), []string{order}))
+	var attempts int
+	var delay float64
+	err = s.client.QueryRow(context.Background(), `SELECT attempts, EXTRACT(EPOCH FROM next_check_at - last_checked_at)
+		FROM orders WHERE number = $1`, order).Scan(&attempts, &delay)
+	assert.NoError(t, err)
+	assert.Equal(t, 101, attempts)
+	assert.Equal(t, time.Hour.Seconds(), delay)
+}
+
+func TestPGSStore_OrderChecks(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	order := "12345678903"
+	assert.NoError(t, s.Register(context.Background(), &u))
+	_, err := s.CollectOrder(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+
+	orders, err := s.ClaimOrders(context.Background(), "test", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+
+	//после проверки заказ не выдается до наступления next_check_at, даже когда аренда снята
+	assert.NoError(t, s.RescheduleOrders(context.Background(), []string{order}))
+	assert.NoError(t, s.ReleaseOrders(context.Background(), "test", nil))
+	orders, err = s.ClaimOrders(context.Background(), "test", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, orders)
+
+	//заказ, арендованный агентом, не признается зависшим до окончания аренды
+	_, err = s.CollectOrder(context.Background(), u.Login, "79927398713")
+	assert.NoError(t, err)
+	orders, err = s.ClaimOrders(context.Background(), "other", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+
+	//uploaded_at хранится с точностью до секунды, поэтому срок берется с запасом в прошлое
+	failed, err := s.FailStaleOrders(context.Background(), -time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed)
+
+	//поздний окончательный ответ по FAILED заказу не применяется
+	changed, err := s.UpdateOrders(context.Background(), storage.SourceAgent, []storage.Orders{{Order: order, Status: "PROCESSED", Accrual: 100}})
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+
+	code, list, err := s.GetFailedOrders(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, OrderFailed, list[0].Status)
+		assert.Equal(t, 1, list[0].Attempts)
+		assert.NotNil(t, list[0].LastCheckedAt)
+	}
+}
+
+func TestPGSStore_ClaimOrders(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	order := "12345678903"
+	assert.NoError(t, s.Register(context.Background(), &u))
+	_, err := s.CollectOrder(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+
+	claimed, err := s.ClaimOrders(context.Background(), "w1", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	//заказ в аренде у w1 не выдается другому экземпляру
+	other, err := s.ClaimOrders(context.Background(), "w2", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, other)
+
+	//после освобождения заказ снова доступен
+	assert.NoError(t, s.ReleaseOrders(context.Background(), "w1", nil))
+	other, err = s.ClaimOrders(context.Background(), "w2", 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, other, 1)
+
+	//повторный ответ по уже рассчитанному заказу не меняет статус и не приводит к начислению
+	processed := []storage.Orders{{Order: order, Status: "PROCESSED", Accrual: 500}}
+	changed, err := s.UpdateOrders(context.Background(), storage.SourceAgent, processed)
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	changed, err = s.UpdateOrders(context.Background(), storage.SourceAgent, processed)
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+}
+
+func TestPGSStore_OrderHistory(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	order := "12345678903"
+	assert.NoError(t, s.Register(context.Background(), &u))
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "other", Password: "123456"}))
+	_, err := s.CollectOrder(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+
+	_, err = s.UpdateOrders(context.Background(), storage.SourceAgent, []storage.Orders{{Order: order, Status: "PROCESSING"}})
+	assert.NoError(t, err)
+	_, err = s.UpdateOrders(context.Background(), storage.SourcePush, []storage.Orders{{Order: order, Status: "PROCESSED", Accrual: 500}})
+	assert.NoError(t, err)
+	//из окончательного статуса выйти нельзя
+	changed, err := s.UpdateOrders(context.Background(), storage.SourceAgent, []storage.Orders{{Order: order, Status: "INVALID"}})
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+
+	code, detail, err := s.GetOrderDetail(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.NotNil(t, detail) && assert.Len(t, detail.History, 3) {
+		assert.Equal(t, "PROCESSED", detail.Status)
+		assert.Equal(t, "NEW", detail.History[0].Status)
+		assert.Equal(t, storage.SourceUser, detail.History[0].Source)
+		assert.Equal(t, "PROCESSING", detail.History[2].OldStatus)
+		assert.Equal(t, storage.SourcePush, detail.History[2].Source)
+		assert.NotNil(t, detail.Withdrawals)
+	}
+
+	//списание на тот же номер попадает в карточку заказа
+	_, err = s.Withdraw(context.Background(), u.Login, &storage.Order{Order: order, Sum: 100})
+	assert.NoError(t, err)
+	_, detail, err = s.GetOrderDetail(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+	if assert.NotNil(t, detail) && assert.Len(t, detail.Withdrawals, 1) {
+		assert.Equal(t, 100.0, detail.Withdrawals[0].Sum)
+	}
+
+	code, _, err = s.GetOrderDetail(context.Background(), "other", order)
+	assert.Error(t, err)
+	assert.Equal(t, 403, code)
+	code, _, err = s.GetOrderDetail(context.Background(), u.Login, "79927398713")
+	assert.Error(t, err)
+	assert.Equal(t, 404, code)
+}
+
+func TestPGSStore_validTransition(t *testing.T) {
+	assert.True(t, validTransition("NEW", "PROCESSING"))
+	assert.True(t, validTransition("PROCESSING", "PROCESSED"))
+	assert.False(t, validTransition("PROCESSING", "REGISTERED"))
+	assert.False(t, validTransition("PROCESSED", "INVALID"))
+	assert.False(t, validTransition("INVALID", "PROCESSED"))
+	assert.False(t, validTransition("NEW", "NEW"))
+	assert.True(t, validTransition("PROCESSED", OrderReversed))
+	assert.False(t, validTransition("NEW", OrderReversed))
+	assert.False(t, validTransition(OrderReversed, "PROCESSED"))
+}
+
+func TestPGSStore_CancelOrder(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	order := "12345678903"
+	assert.NoError(t, s.Register(context.Background(), &u))
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "other", Password: "123456"}))
+	_, err := s.CollectOrder(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+
+	code, err := s.CancelOrder(context.Background(), "other", order)
+	assert.Error(t, err)
+	assert.Equal(t, 403, code)
+
+	code, err = s.CancelOrder(context.Background(), u.Login, order)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+
+	code, err = s.CancelOrder(context.Background(), u.Login, order)
+	assert.Error(t, err)
+	assert.Equal(t, 404, code)
+
+	//номер освобожден, и его может загрузить другой пользователь
+	code, err = s.CollectOrder(context.Background(), "other", order)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, code)
+
+	//заказ, который агент уже проверял, отменить нельзя
+	assert.NoError(t, s.RescheduleOrders(context.Background(), []string{order}))
+	code, err = s.CancelOrder(context.Background(), "other", order)
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+}
+
+func TestPGSStore_PointsExpiry(t *testing.T) {
+	cfg := CFG
+	cfg.PointsExpiringSoon = 48 * time.Hour
+	s, teardown := TestPGStore(t, cfg)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	assert.NoError(t, s.Register(context.Background(), &u))
+	userID, err := s.GetUserID(context.Background(), u.Login)
+	assert.NoError(t, err)
+	for _, order := range []string{"12345678903", "79927398713"} {
+		_, err = s.CollectOrder(context.Background(), u.Login, order)
+		assert.NoError(t, err)
+	}
+
+	//первая партия сгорает через сутки, вторая бессрочная
+	s.pointsTTL = 24 * time.Hour
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 300}}))
+	s.pointsTTL = 0
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "79927398713", Status: "PROCESSED", Accrual: 200}}))
+
+	balance, err := s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 500.0, balance.Current)
+	if assert.Len(t, balance.ExpiringSoon, 1) {
+		assert.Equal(t, 300.0, balance.ExpiringSoon[0].Amount)
+	}
+
+	//списание идет из партии, которая сгорит раньше
+	_, err = s.Withdraw(context.Background(), u.Login, &storage.Order{Order: "2377225624", Sum: 100})
+	assert.NoError(t, err)
+
+	_, err = s.client.Exec(context.Background(), `UPDATE point_lots SET expires_at = current_timestamp - interval '1 second' WHERE expires_at IS NOT NULL`)
+	assert.NoError(t, err)
+
+	report, err := s.ExpirePoints(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.PointsExpiry{{UserID: userID, Amount: 200, Lots: 1}}, report)
+	balance, err = s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 400.0, balance.Current)
+
+	report, err = s.ExpirePoints(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, report, 1)
+	balance, err = s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 200.0, balance.Current)
+	assert.Empty(t, balance.ExpiringSoon)
+}
+
+func TestPGSStore_LapsedLots(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "holds", "transfers")
+
+	for _, login := range []string{"test", "other"} {
+		assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: login, Password: "123456"}))
+	}
+	userID, err := s.GetUserID(context.Background(), "test")
+	assert.NoError(t, err)
+	for _, order := range []string{"12345678903", "79927398713"} {
+		_, err = s.CollectOrder(context.Background(), "test", order)
+		assert.NoError(t, err)
+	}
+	s.pointsTTL = 24 * time.Hour
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 300}}))
+	s.pointsTTL = 0
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "79927398713", Status: "PROCESSED", Accrual: 200}}))
+	//срок первой партии истек, но ExpirePoints ее еще не обработал
+	_, err = s.client.Exec(context.Background(), `UPDATE point_lots SET expires_at = current_timestamp - interval '1 second' WHERE expires_at IS NOT NULL`)
+	assert.NoError(t, err)
+
+	//истекшие баллы недоступны ни для одной операции
+	code, err := s.Withdraw(context.Background(), "test", &storage.Order{Order: "2377225624", Sum: 300})
+	assert.Error(t, err)
+	assert.Equal(t, 402, code)
+	code, err = s.CreateHold(context.Background(), "test", &storage.Hold{Order: "2377225624", Sum: 300})
+	assert.Error(t, err)
+	assert.Equal(t, 402, code)
+	code, err = s.Transfer(context.Background(), "test", &storage.Transfer{To: "other", Amount: 300})
+	assert.Error(t, err)
+	assert.Equal(t, 402, code)
+
+	//списание сначала сжигает истекшую партию, затем расходует бессрочную
+	code, err = s.Withdraw(context.Background(), "test", &storage.Order{Order: "2377225624", Sum: 150})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	balance, err := s.GetBalance(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 50.0, balance.Current)
+	var expired float64
+	err = s.client.QueryRow(context.Background(), `SELECT COALESCE(SUM(amount), 0) FROM balance_ledger WHERE user_id = $1 AND kind = $2`,
+		userID, storage.LedgerExpiry).Scan(&expired)
+	assert.NoError(t, err)
+	assert.Equal(t, -300.0, expired)
+
+	//сгоревшую партию ExpirePoints повторно не обрабатывает
+	report, err := s.ExpirePoints(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Empty(t, report)
+}
+
+func TestPGSStore_LoyaltyTiers(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "tier_history")
+
+	var u = storage.AcceptUser{
+		Login:    "test",
+		Password: "123456",
+	}
+	assert.NoError(t, s.Register(context.Background(), &u))
+	userID, err := s.GetUserID(context.Background(), u.Login)
+	assert.NoError(t, err)
+	for _, order := range []string{"12345678903", "79927398713"} {
+		_, err = s.CollectOrder(context.Background(), u.Login, order)
+		assert.NoError(t, err)
+	}
+
+	code, _, err := s.GetTierHistory(context.Background(), u.Login)
+	assert.Error(t, err)
+	assert.Equal(t, 204, code)
+
+	//на базовом уровне начисление не увеличивается, сумма за год переводит пользователя на SILVER
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 1000}}))
+	balance, err := s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, balance.Current)
+	assert.Equal(t, "SILVER", balance.Tier)
+
+	//на уровне SILVER к начислению применяется множитель
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "79927398713", Status: "PROCESSED", Accrual: 100}}))
+	balance, err = s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1110.0, balance.Current, 1e-9)
+
+	code, history, err := s.GetTierHistory(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "BASE", history[0].OldTier)
+		assert.Equal(t, "SILVER", history[0].Tier)
+		assert.Equal(t, 1000.0, history[0].RollingPoints)
+	}
+
+	//отмененное начисление не учитывается, и уровень пересчитывается сразу
+	code, err = s.Clawback(context.Background(), storage.SourceSystem, &storage.Clawback{Order: "12345678903"})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	balance, err = s.GetBalance(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, "BASE", balance.Tier)
+	code, history, err = s.GetTierHistory(context.Background(), u.Login)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "SILVER", history[0].OldTier)
+		assert.Equal(t, "BASE", history[0].Tier)
+		assert.InDelta(t, 110.0, history[0].RollingPoints, 1e-9)
+	}
+}
+
+func TestPGSStore_Campaigns(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "outbox", "point_lots", "balance_ledger", "campaigns", "promo_redemptions")
+
+	for _, login := range []string{"first", "second"} {
+		assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: login, Password: "123456"}))
+	}
+	ended := time.Now().Add(-time.Hour)
+	code, err := s.CreateCampaign(context.Background(), &storage.Campaign{Code: "old", Bonus: 10, EndsAt: &ended})
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	c := storage.Campaign{Code: " welcome ", Bonus: 100, MaxRedemptions: 1}
+	code, err = s.CreateCampaign(context.Background(), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	assert.Equal(t, "WELCOME", c.Code)
+	assert.Equal(t, 1, c.PerUserLimit)
+
+	code, err = s.CreateCampaign(context.Background(), &storage.Campaign{Code: "WELCOME", Bonus: 5})
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+	code, err = s.CreateCampaign(context.Background(), &storage.Campaign{Code: "ZERO"})
+	assert.Error(t, err)
+	assert.Equal(t, 400, code)
+
+	code, _, err = s.RedeemPromo(context.Background(), "first", "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 404, code)
+	code, _, err = s.RedeemPromo(context.Background(), "first", "old")
+	assert.Error(t, err)
+	assert.Equal(t, 422, code)
+
+	code, r, err := s.RedeemPromo(context.Background(), "first", "welcome")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 100.0, r.Bonus)
+	balance, err := s.GetBalance(context.Background(), "first")
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, balance.Current)
+	//бонусы не влияют на уровень лояльности
+	assert.Equal(t, "BASE", balance.Tier)
+
+	//общий лимит погашений исчерпан
+	code, _, err = s.RedeemPromo(context.Background(), "second", "WELCOME")
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+
+	code, campaigns, err := s.GetCampaigns(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, campaigns, 2) {
+		assert.Equal(t, 1, campaigns[1].Redemptions)
+		assert.Equal(t, 100.0, campaigns[1].RedeemedPoints)
+	}
+	code, redemptions, err := s.GetCampaignRedemptions(context.Background(), c.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Len(t, redemptions, 1)
+}
+
+func TestPGSStore_Transfer(t *testing.T) {
+	cfg := CFG
+	cfg.TransferDailyLimit = 300
+	cfg.TransferMinBalance = 50
+	s, teardown := TestPGStore(t, cfg)
+	defer teardown("users", "orders", "outbox", "order_status_history", "point_lots", "balance_ledger", "transfers")
+
+	for _, login := range []string{"sender", "recipient"} {
+		assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: login, Password: "123456"}))
+	}
+	senderID, err := s.GetUserID(context.Background(), "sender")
+	assert.NoError(t, err)
+	_, err = s.CollectOrder(context.Background(), "sender", "12345678903")
+	assert.NoError(t, err)
+	s.pointsTTL = 24 * time.Hour
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: senderID, Order: "12345678903", Status: "PROCESSED", Accrual: 500}}))
+
+	code, err := s.Transfer(context.Background(), "sender", &storage.Transfer{To: "sender", Amount: 10})
+	assert.Error(t, err)
+	assert.Equal(t, 400, code)
+	code, err = s.Transfer(context.Background(), "sender", &storage.Transfer{To: "nobody", Amount: 10})
+	assert.Error(t, err)
+	assert.Equal(t, 404, code)
+
+	tr := storage.Transfer{To: "recipient", Amount: 200}
+	code, err = s.Transfer(context.Background(), "sender", &tr)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, storage.TransferOut, tr.Direction)
+	recipientID, err := s.GetUserID(context.Background(), "recipient")
+	assert.NoError(t, err)
+	//событие о переводе адресовано и отправителю, и получателю
+	claimed, err := s.ClaimEvents(context.Background(), 100, time.Minute)
+	assert.NoError(t, err)
+	var notified []int
+	for _, e := range claimed {
+		if e.Type == events.TypeBalanceTransferred {
+			userID, err := e.UserID()
+			assert.NoError(t, err)
+			notified = append(notified, userID)
+		}
+	}
+	assert.ElementsMatch(t, []int{senderID, recipientID}, notified)
+
+	//дневной лимит 300 уже почти исчерпан
+	code, err = s.Transfer(context.Background(), "sender", &storage.Transfer{To: "recipient", Amount: 150})
+	assert.Error(t, err)
+	assert.Equal(t, 422, code)
+
+	balance, err := s.GetBalance(context.Background(), "recipient")
+	assert.NoError(t, err)
+	assert.Equal(t, 200.0, balance.Current)
+	//переведенные баллы сохраняют срок действия партии отправителя
+	var expiring int
+	err = s.client.QueryRow(context.Background(), `SELECT COUNT(*) FROM point_lots l JOIN users u ON u.id = l.user_id
+		WHERE u.login = 'recipient' AND l.expires_at IS NOT NULL`).Scan(&expiring)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expiring)
+
+	code, transfers, err := s.Transfers(context.Background(), "recipient")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, transfers, 1) {
+		assert.Equal(t, "sender", transfers[0].From)
+		assert.Equal(t, storage.TransferIn, transfers[0].Direction)
+	}
+
+	//минимальный остаток 50 не дает перевести весь баланс
+	s.transferDailyLimit = 0
+	code, err = s.Transfer(context.Background(), "sender", &storage.Transfer{To: "recipient", Amount: 300})
+	assert.Error(t, err)
+	assert.Equal(t, 402, code)
+}
+
+func TestPGSStore_RefundWithdrawal(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "refunds")
+
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "test", Password: "123456"}))
+	userID, err := s.GetUserID(context.Background(), "test")
+	assert.NoError(t, err)
+	_, err = s.CollectOrder(context.Background(), "test", "12345678903")
+	assert.NoError(t, err)
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 500}}))
+	_, err = s.Withdraw(context.Background(), "test", &storage.Order{Order: "2377225624", Sum: 300})
+	assert.NoError(t, err)
+
+	code, err := s.RefundWithdrawal(context.Background(), storage.SourceAdmin, &storage.Refund{Order: "79927398713", Sum: 10})
+	assert.Error(t, err)
+	assert.Equal(t, 404, code)
+
+	code, err = s.RefundWithdrawal(context.Background(), storage.SourceAdmin, &storage.Refund{Order: "2377225624", Sum: 100, Reason: "partial"})
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	code, err = s.RefundWithdrawal(context.Background(), storage.SourceAdmin, &storage.Refund{Order: "2377225624", Sum: 250})
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+
+	//без суммы возвращается весь остаток
+	r := storage.Refund{Order: "2377225624"}
+	code, err = s.RefundWithdrawal(context.Background(), storage.SourceSystem, &r)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	assert.Equal(t, 200.0, r.Sum)
+
+	code, err = s.RefundWithdrawal(context.Background(), storage.SourceAdmin, &storage.Refund{Order: "2377225624"})
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+
+	balance, err := s.GetBalance(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 500.0, balance.Current)
+	assert.Equal(t, 0.0, balance.Withdrawn)
+
+	code, refunds, err := s.GetRefunds(context.Background(), "2377225624")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, refunds, 2) {
+		assert.Equal(t, storage.SourceAdmin, refunds[0].Source)
+		assert.Equal(t, "partial", refunds[0].Reason)
+		assert.Equal(t, storage.SourceSystem, refunds[1].Source)
+	}
+	code, withdrawals, err := s.Withdrawals(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, withdrawals, 1) {
+		assert.Equal(t, 300.0, withdrawals[0].Refunded)
+	}
+}
+
+func TestPGSStore_Clawback(t *testing.T) {
+	tests := []struct {
+		name            string
+		mode            string
+		expectedCurrent float64
+		expectedDebt    float64
+		withdrawCode    int
+	}{
+		{
+			name:            "negative balance",
+			mode:            ClawbackNegative,
+			expectedCurrent: -300,
+			expectedDebt:    300,
+			withdrawCode:    402,
+		},
+		{
+			name:            "blocked until repaid",
+			mode:            ClawbackBlock,
+			expectedCurrent: 0,
+			expectedDebt:    300,
+			withdrawCode:    402,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CFG
+			cfg.ClawbackMode = tt.mode
+			s, teardown := TestPGStore(t, cfg)
+			defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger")
+
+			assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "test", Password: "123456"}))
+			userID, err := s.GetUserID(context.Background(), "test")
+			assert.NoError(t, err)
+			for _, order := range []string{"12345678903", "79927398713"} {
+				_, err = s.CollectOrder(context.Background(), "test", order)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 500}}))
+			_, err = s.Withdraw(context.Background(), "test", &storage.Order{Order: "2377225624", Sum: 300})
+			assert.NoError(t, err)
+
+			code, err := s.Clawback(context.Background(), storage.SourceSystem, &storage.Clawback{Order: "79927398713"})
+			assert.Error(t, err)
+			assert.Equal(t, 409, code)
+
+			c := storage.Clawback{Order: "12345678903"}
+			code, err = s.Clawback(context.Background(), storage.SourceSystem, &c)
+			assert.NoError(t, err)
+			assert.Equal(t, 200, code)
+			assert.Equal(t, 500.0, c.Amount)
+			assert.Equal(t, tt.expectedCurrent, c.Current)
+			assert.Equal(t, tt.expectedDebt, c.Debt)
+
+			//повторная отмена невозможна
+			code, err = s.Clawback(context.Background(), storage.SourceSystem, &storage.Clawback{Order: "12345678903"})
+			assert.Error(t, err)
+			assert.Equal(t, 409, code)
+
+			code, detail, err := s.GetOrderDetail(context.Background(), "test", "12345678903")
+			assert.NoError(t, err)
+			assert.Equal(t, 200, code)
+			assert.Equal(t, OrderReversed, detail.Status)
+			last := detail.History[len(detail.History)-1]
+			assert.Equal(t, OrderReversed, last.Status)
+			assert.Equal(t, storage.SourceSystem, last.Source)
+
+			code, err = s.Withdraw(context.Background(), "test", &storage.Order{Order: "49927398716", Sum: 1})
+			assert.Error(t, err)
+			assert.Equal(t, tt.withdrawCode, code)
+
+			//новое начисление сначала гасит долг
+			assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "79927398713", Status: "PROCESSED", Accrual: 400}}))
+			balance, err := s.GetBalance(context.Background(), "test")
+			assert.NoError(t, err)
+			assert.Equal(t, 100.0, balance.Current)
+			assert.Equal(t, 0.0, balance.Debt)
+		})
+	}
+}
+
+func TestPGSStore_Holds(t *testing.T) {
+	cfg := CFG
+	cfg.HoldTTL = time.Minute
+	s, teardown := TestPGStore(t, cfg)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "holds")
+
+	for _, login := range []string{"test", "other"} {
+		assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: login, Password: "123456"}))
+	}
+	userID, err := s.GetUserID(context.Background(), "test")
+	assert.NoError(t, err)
+	_, err = s.CollectOrder(context.Background(), "test", "12345678903")
+	assert.NoError(t, err)
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 500}}))
+
+	first := storage.Hold{Order: "2377225624", Sum: 300}
+	code, err := s.CreateHold(context.Background(), "test", &first)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	code, err = s.CreateHold(context.Background(), "test", &storage.Hold{Order: "2377225624", Sum: 10})
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+
+	balance, err := s.GetBalance(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 500.0, balance.Current)
+	assert.Equal(t, 300.0, balance.Held)
+	assert.Equal(t, 200.0, balance.Available)
+
+	//удержанные баллы недоступны для списания
+	code, err = s.Withdraw(context.Background(), "test", &storage.Order{Order: "49927398716", Sum: 250})
+	assert.Error(t, err)
+	assert.Equal(t, 402, code)
+
+	code, err = s.ReleaseHold(context.Background(), "other", first.ID)
+	assert.Error(t, err)
+	assert.Equal(t, 403, code)
+
+	code, captured, err := s.CaptureHold(context.Background(), "test", first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, HoldCaptured, captured.Status)
+	code, err = s.ReleaseHold(context.Background(), "test", first.ID)
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+
+	balance, err = s.GetBalance(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 200.0, balance.Current)
+	assert.Equal(t, 300.0, balance.Withdrawn)
+	assert.Equal(t, 0.0, balance.Held)
+
+	second := storage.Hold{Order: "49927398716", Sum: 100}
+	code, err = s.CreateHold(context.Background(), "test", &second)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	_, err = s.client.Exec(context.Background(), `UPDATE holds SET expires_at = current_timestamp - interval '1 second' WHERE id = $1`, second.ID)
+	assert.NoError(t, err)
+	code, _, err = s.CaptureHold(context.Background(), "test", second.ID)
+	assert.Error(t, err)
+	assert.Equal(t, 409, code)
+	n, err := s.ExpireHolds(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	code, holds, err := s.GetHolds(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	if assert.Len(t, holds, 2) {
+		assert.Equal(t, HoldExpired, holds[0].Status)
+		assert.Equal(t, HoldCaptured, holds[1].Status)
+	}
+}
+
+func TestPGSStore_WithdrawPolicy(t *testing.T) {
+	cfg := CFG
+	cfg.HoldTTL = time.Minute
+	cfg.WithdrawMinSum = 10
+	cfg.WithdrawMaxSum = 400
+	cfg.WithdrawDailyCap = 500
+	cfg.WithdrawMaxOrderShare = 50
+	s, teardown := TestPGStore(t, cfg)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "holds")
+
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "test", Password: "123456"}))
+	userID, err := s.GetUserID(context.Background(), "test")
+	assert.NoError(t, err)
+	_, err = s.CollectOrder(context.Background(), "test", "12345678903")
 	assert.NoError(t, err)
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 1000}}))
+
+	tests := []struct {
+		name  string
+		order storage.Order
+		rule  string
+	}{
+		{name: "negative", order: storage.Order{Order: "2377225624", Sum: -5}, rule: policy.RulePositiveSum},
+		{name: "min", order: storage.Order{Order: "2377225624", Sum: 5}, rule: policy.RuleMinSum},
+		{name: "max", order: storage.Order{Order: "2377225624", Sum: 450}, rule: policy.RuleMaxSum},
+		{name: "order share", order: storage.Order{Order: "2377225624", Sum: 300, Total: 400}, rule: policy.RuleMaxOrderShare},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := s.Withdraw(context.Background(), "test", &tt.order)
+			assert.Equal(t, 422, code)
+			var v *policy.Violation
+			assert.ErrorAs(t, err, &v)
+			assert.Equal(t, tt.rule, v.Rule)
+		})
+	}
+
+	code, err := s.Withdraw(context.Background(), "test", &storage.Order{Order: "2377225624", Sum: 300, Total: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	//действующее удержание учитывается в дневном лимите
+	code, err = s.CreateHold(context.Background(), "test", &storage.Hold{Order: "49927398716", Sum: 150})
+	assert.NoError(t, err)
+	assert.Equal(t, 201, code)
+	code, err = s.Withdraw(context.Background(), "test", &storage.Order{Order: "79927398713", Sum: 100})
+	assert.Equal(t, 422, code)
+	var v *policy.Violation
+	assert.ErrorAs(t, err, &v)
+	assert.Equal(t, policy.RuleDailyCap, v.Rule)
+	assert.Equal(t, 550.0, v.Actual)
+}
+
+// statementRecorder сохраняет выписку, переданную хранилищем.
+type statementRecorder struct {
+	opening float64
+	entries []storage.StatementEntry
+}
+
+func (r *statementRecorder) Begin(opening float64) error {
+	r.opening = opening
+	return nil
+}
+
+func (r *statementRecorder) Entry(e storage.StatementEntry) error {
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+func TestPGSStore_Statement(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "balance_withdrawn", "outbox", "order_status_history", "point_lots", "balance_ledger", "tier_history")
+
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "test", Password: "123456"}))
+	userID, err := s.GetUserID(context.Background(), "test")
+	assert.NoError(t, err)
+	for _, number := range []string{"12345678903", "79927398713"} {
+		_, err = s.CollectOrder(context.Background(), "test", number)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "12345678903", Status: "PROCESSED", Accrual: 500}}))
+	//первое начисление зачислено до начала периода и попадает во входящий остаток
+	_, err = s.client.Exec(context.Background(), `UPDATE balance_ledger SET created_at = created_at - interval '2 days'`)
+	assert.NoError(t, err)
+	//заказ загружен до начала периода, но начисление датируется моментом зачисления
+	_, err = s.client.Exec(context.Background(), `UPDATE orders SET uploaded_at = uploaded_at - interval '3 days' WHERE number = $1`, "79927398713")
+	assert.NoError(t, err)
+	assert.NoError(t, processOrders(s, []storage.Orders{{UserID: userID, Order: "79927398713", Status: "PROCESSED", Accrual: 200}}))
+	code, err := s.Withdraw(context.Background(), "test", &storage.Order{Order: "2377225624", Sum: 150})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	//отмена начисления не меняет входящий остаток, а попадает в период отдельной операцией
+	code, err = s.Clawback(context.Background(), storage.SourceSystem, &storage.Clawback{Order: "12345678903"})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+
+	var r statementRecorder
+	code, err = s.Statement(context.Background(), "test", time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour), &r)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 500.0, r.opening)
+	closing := r.opening
+	if assert.Len(t, r.entries, 3) {
+		assert.Equal(t, storage.LedgerAccrual, r.entries[0].Kind)
+		assert.Equal(t, "79927398713", r.entries[0].Reference)
+		assert.Equal(t, 200.0, r.entries[0].Amount)
+		assert.Equal(t, storage.LedgerWithdrawal, r.entries[1].Kind)
+		assert.Equal(t, -150.0, r.entries[1].Amount)
+		assert.Equal(t, storage.LedgerClawback, r.entries[2].Kind)
+		assert.Equal(t, -500.0, r.entries[2].Amount)
+		for _, e := range r.entries {
+			closing += e.Amount
+		}
+	}
+	//исходящий остаток совпадает с балансом пользователя
+	balance, err := s.GetBalance(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.InDelta(t, balance.Current, closing, 1e-9)
+
+	code, err = s.Statement(context.Background(), "test", time.Now(), time.Now().Add(-time.Hour), &r)
+	assert.Error(t, err)
+	assert.Equal(t, 400, code)
+}
+
+func TestPGSStore_Import(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "orders", "order_status_history", "point_lots", "balance_ledger", "import_progress")
+	ctx := context.Background()
+
+	assert.NoError(t, s.Register(context.Background(), &storage.AcceptUser{Login: "existing", Password: "123456"}))
+	hash := s.hashPassword("secret")
+	rejected, err := s.ImportUsers(ctx, "users:test", 3, []storage.ImportUser{
+		{Line: 2, Login: "alice", HashedPassword: hash, Current: 300, Withdrawn: 50},
+		{Line: 3, Login: "existing", HashedPassword: hash},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ImportRejection{{Line: 3, Reason: "login already exists"}}, rejected)
+	line, err := s.ImportProgress(ctx, "users:test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), line)
+
+	//хэш переносится без изменений, поэтому пользователь входит со старым паролем
+	assert.NoError(t, s.Login(context.Background(), &storage.AcceptUser{Login: "alice", Password: "secret"}))
+	balance, err := s.GetBalance(context.Background(), "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 300.0, balance.Current)
+	assert.Equal(t, 50.0, balance.Withdrawn)
+	code, err := s.Withdraw(context.Background(), "alice", &storage.Order{Order: "2377225624", Sum: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+
+	uploaded := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rejected, err = s.ImportOrders(ctx, "orders:test", 4, []storage.ImportOrder{
+		{Line: 1, Login: "alice", Number: "12345678903", Status: "PROCESSED", Accrual: 500, UploadedAt: uploaded},
+		{Line: 2, Login: "nobody", Number: "79927398713", Status: "NEW", UploadedAt: uploaded},
+		{Line: 4, Login: "alice", Number: "49927398716", Status: "NEW", UploadedAt: uploaded},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ImportRejection{{Line: 2, Reason: "unknown user"}}, rejected)
+	rejected, err = s.ImportOrders(ctx, "orders:test", 5, []storage.ImportOrder{
+		{Line: 5, Login: "alice", Number: "12345678903", Status: "NEW", UploadedAt: uploaded},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ImportRejection{{Line: 5, Reason: "order already exists"}}, rejected)
+	code, orders, err := s.GetOrder(context.Background(), "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Len(t, orders, 2)
+
+	//источник — абсолютный путь к файлу, он может быть длиннее прежних VARCHAR
+	source := "users:/" + strings.Repeat("dir/", 150) + "users.csv"
+	rejected, err = s.ImportUsers(ctx, source, 1, []storage.ImportUser{
+		{Line: 1, Login: "bob", HashedPassword: hash, Current: 10},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, rejected)
+	line, err = s.ImportProgress(ctx, source)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), line)
+}
+
+// processOrders проводит заказы как рассчитанные системой начислений вместе с начислением баллов.
+func processOrders(s *PGSStore, orders []storage.Orders) error {
+	_, err := s.UpdateOrders(context.Background(), storage.SourceAgent, orders)
+	return err
 }
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// RefundWithdrawal возвращает баллы по списанию r.Order полностью или частично:
+// сумма возврата прибавляется к текущему балансу и вычитается из списанного.
+// Вернуть больше, чем было списано, нельзя.
+func (p *PGSStore) RefundWithdrawal(ctx context.Context, source string, r *storage.Refund) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.RefundWithdrawal", trace.WithAttributes(
+		attribute.String(tracing.AttrOrderNumber, r.Order),
+		attribute.String("source", source),
+	))
+	defer span.End()
+	if r.Order == "" {
+		return 400, fmt.Errorf("empty withdrawal order")
+	}
+	if r.Sum < 0 {
+		return 400, fmt.Errorf("wrong refund sum %v", r.Sum)
+	}
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	//строка списания блокируется, чтобы параллельные возвраты не превысили его сумму
+	var userID int
+	var sum, refunded float64
+	q := `SELECT user_id, sum, refunded FROM balance_withdrawn WHERE orders = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, r.Order).Scan(&userID, &sum, &refunded); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, fmt.Errorf("withdrawal %s not found", r.Order)
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	left := sum - refunded
+	if left <= pointsEpsilon {
+		return 409, fmt.Errorf("withdrawal %s is already refunded", r.Order)
+	}
+	if r.Sum == 0 {
+		r.Sum = left
+	}
+	if r.Sum > left+pointsEpsilon {
+		return 409, fmt.Errorf("refund exceeds withdrawn sum, %v left", left)
+	}
+	q = `UPDATE balance_withdrawn SET refunded = refunded + $1 WHERE orders = $2`
+	if _, err = tx.Exec(ctx, q, r.Sum, r.Order); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	q = `UPDATE users SET balance_current = balance_current + $1, balance_withdrawn = balance_withdrawn - $1
+		WHERE id = $2`
+	if _, err = tx.Exec(ctx, q, r.Sum, userID); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	r.Source = source
+	q = `INSERT INTO refunds (withdrawal, user_id, sum, reason, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, current_timestamp) RETURNING id, created_at`
+	if err = tx.QueryRow(ctx, q, r.Order, userID, r.Sum, r.Reason, r.Source).Scan(&r.ID, &r.CreatedAt); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	//возвращенные баллы зачисляются новой партией с обычным сроком действия
+	if err = addLot(ctx, tx, userID, storage.LedgerRefund, r.Order, r.Sum, p.pointsTTL); err != nil {
+		p.logger.LogErr(err, "failed to add points")
+		return 500, err
+	}
+	if err = p.repayDebt(ctx, tx, userID); err != nil {
+		p.logger.LogErr(err, "failed to repay clawback debt")
+		return 500, err
+	}
+	err = insertEvent(ctx, tx, events.TypeBalanceRefunded, strconv.FormatInt(r.ID, 10), events.BalanceRefunded{
+		RefundID: r.ID,
+		UserID:   userID,
+		Order:    r.Order,
+		Sum:      r.Sum,
+	})
+	if err != nil {
+		p.logger.LogErr(err, "failed to insert event")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 201, nil
+}
+
+// GetRefunds возвращает возвраты по списанию order в порядке оформления.
+func (p *PGSStore) GetRefunds(ctx context.Context, order string) (int, []storage.Refund, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetRefunds", trace.WithAttributes(
+		attribute.String(tracing.AttrOrderNumber, order),
+	))
+	defer span.End()
+	var exists bool
+	q := `SELECT EXISTS (SELECT 1 FROM balance_withdrawn WHERE orders = $1)`
+	if err := p.replica.QueryRow(ctx, q, order).Scan(&exists); err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	if !exists {
+		return 404, nil, fmt.Errorf("withdrawal %s not found", order)
+	}
+	q = `SELECT id, withdrawal, sum, reason, source, created_at FROM refunds WHERE withdrawal = $1 ORDER BY id`
+	rows, err := p.replica.Query(ctx, q, order)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var refunds []storage.Refund
+	for rows.Next() {
+		var r storage.Refund
+		if err = rows.Scan(&r.ID, &r.Order, &r.Sum, &r.Reason, &r.Source, &r.CreatedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if len(refunds) == 0 {
+		return 204, nil, fmt.Errorf("no one refund")
+	}
+	return 200, refunds, nil
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// Statement передает в w выписку пользователя за период [from, to) по журналу движения баллов:
+// начисления с учетом множителя уровня, промо, переводы, возвраты, отмены, сгорания и списания
+// датируются моментом, когда они изменили баланс. Записи одной операции по нескольким партиям
+// объединяются. Остаток и операции читаются в одной транзакции REPEATABLE READ, поэтому выписка
+// согласована, а строки отдаются по одной по мере чтения.
+func (p *PGSStore) Statement(ctx context.Context, login string, from, to time.Time, w storage.StatementWriter) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.Statement", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	if !from.Before(to) {
+		return 400, fmt.Errorf("statement period is empty")
+	}
+	tx, err := p.replica.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	var userID int
+	if err = tx.QueryRow(ctx, `SELECT id FROM users WHERE login = $1`, login).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 500, fmt.Errorf("no user")
+		}
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	var opening float64
+	q := `SELECT COALESCE(SUM(amount), 0) FROM balance_ledger WHERE user_id = $1 AND created_at < $2`
+	if err = tx.QueryRow(ctx, q, userID, from).Scan(&opening); err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	if err = w.Begin(opening); err != nil {
+		return 500, err
+	}
+	//записи одной транзакции имеют одинаковое время, поэтому операция — это группа записей
+	//с общим временем, видом и основанием; взаимно погашенные записи в выписку не попадают
+	q = `SELECT created_at, kind, reference, SUM(amount) FROM balance_ledger
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY created_at, kind, reference
+		HAVING ABS(SUM(amount)) > $4
+		ORDER BY created_at, MIN(id)`
+	rows, err := tx.Query(ctx, q, userID, from, to, pointsEpsilon)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e storage.StatementEntry
+		if err = rows.Scan(&e.Date, &e.Kind, &e.Reference, &e.Amount); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, err
+		}
+		if err = w.Entry(e); err != nil {
+			return 500, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, err
+	}
+	return 200, nil
+}
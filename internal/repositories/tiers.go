@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// tierWindow — период, за который суммируются начисления для определения уровня.
+const tierWindow = "12 months"
+
+// userTier блокирует строку пользователя и возвращает его уровень лояльности и множитель начислений.
+// Если пользователя нет, возвращает pgx.ErrNoRows.
+func userTier(ctx context.Context, tx pgx.Tx, userID int) (string, float64, error) {
+	var tier string
+	var multiplier float64
+	q := `SELECT u.tier, COALESCE(t.multiplier, 1) FROM users u
+		LEFT JOIN loyalty_tiers t ON t.name = u.tier
+		WHERE u.id = $1 FOR UPDATE OF u`
+	if err := tx.QueryRow(ctx, q, userID).Scan(&tier, &multiplier); err != nil {
+		return "", 0, err
+	}
+	return tier, multiplier, nil
+}
+
+// recalculateTier пересчитывает уровень пользователя по сумме начислений за tierWindow.
+// Начисления по отмененным (REVERSED) заказам не учитываются. При смене уровня записывает
+// историю и событие tier.changed.
+func recalculateTier(ctx context.Context, tx pgx.Tx, userID int, current string) error {
+	var rolling float64
+	q := `SELECT COALESCE(SUM(l.amount), 0) FROM balance_ledger l
+		WHERE l.user_id = $1 AND l.kind = $2 AND l.created_at > current_timestamp - $3::interval
+			AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.number = l.reference AND o.status = $4)`
+	if err := tx.QueryRow(ctx, q, userID, storage.LedgerAccrual, tierWindow, OrderReversed).Scan(&rolling); err != nil {
+		return err
+	}
+	var tier string
+	q = `SELECT name FROM loyalty_tiers WHERE min_points <= $1 ORDER BY min_points DESC LIMIT 1`
+	if err := tx.QueryRow(ctx, q, rolling).Scan(&tier); err != nil {
+		//без настроенных уровней пользователь остается на текущем
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if tier == current {
+		return nil
+	}
+	q = `UPDATE users SET tier = $1 WHERE id = $2`
+	if _, err := tx.Exec(ctx, q, tier, userID); err != nil {
+		return err
+	}
+	q = `INSERT INTO tier_history (user_id, old_tier, tier, rolling_points, created_at)
+		VALUES ($1, $2, $3, $4, current_timestamp)`
+	if _, err := tx.Exec(ctx, q, userID, current, tier, rolling); err != nil {
+		return err
+	}
+	return insertEvent(ctx, tx, events.TypeTierChanged, strconv.Itoa(userID), events.TierChanged{
+		UserID:        userID,
+		OldTier:       current,
+		Tier:          tier,
+		RollingPoints: rolling,
+	})
+}
+
+// GetTierHistory возвращает историю смены уровня лояльности пользователя.
+func (p *PGSStore) GetTierHistory(ctx context.Context, login string) (int, []storage.TierChange, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetTierHistory", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	q := `SELECT h.old_tier, h.tier, h.rolling_points, h.created_at FROM tier_history h
+		JOIN users u ON u.id = h.user_id WHERE u.login = $1 ORDER BY h.created_at DESC, h.id DESC`
+	rows, err := p.replica.Query(ctx, q, login)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var history []storage.TierChange
+	for rows.Next() {
+		var c storage.TierChange
+		if err = rows.Scan(&c.OldTier, &c.Tier, &c.RollingPoints, &c.CreatedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		history = append(history, c)
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if len(history) == 0 {
+		return 204, nil, fmt.Errorf("no tier changes")
+	}
+	return 200, history, nil
+}
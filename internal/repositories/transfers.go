@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/tracing"
+)
+
+// Transfer переводит баллы пользователя login получателю t.To. Обе строки пользователей
+// блокируются в порядке id, чтобы встречные переводы не взаимоблокировались.
+func (p *PGSStore) Transfer(ctx context.Context, login string, t *storage.Transfer) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.Transfer", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	if t.Amount <= 0 {
+		return 400, fmt.Errorf("wrong transfer amount %v", t.Amount)
+	}
+	if t.To == "" || t.To == login {
+		return 400, fmt.Errorf("wrong transfer recipient")
+	}
+	tx, err := p.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		p.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+	q := `SELECT id, login, balance_current, clawback_debt FROM users WHERE login = $1 OR login = $2 ORDER BY id FOR UPDATE`
+	rows, err := tx.Query(ctx, q, login, t.To)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	var sender, recipient *storage.User
+	for rows.Next() {
+		var u storage.User
+		if err = rows.Scan(&u.ID, &u.Login, &u.Accrual.Current, &u.Accrual.Debt); err != nil {
+			rows.Close()
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, err
+		}
+		if u.Login == login {
+			sender = &u
+		} else {
+			recipient = &u
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, err
+	}
+	if sender == nil {
+		return 500, fmt.Errorf("no user")
+	}
+	if recipient == nil {
+		return 404, fmt.Errorf("recipient %s not found", t.To)
+	}
+	if p.blockedByDebt(sender.Accrual.Debt) {
+		return 402, fmt.Errorf("transfers are blocked until clawback debt is repaid")
+	}
+	//истекшие баллы отправителя сгорают до проверки суммы и не переходят получателю
+	if sender.Accrual.Current, err = p.expireLapsedLots(ctx, tx, sender.ID, sender.Accrual.Current); err != nil {
+		p.logger.LogErr(err, "failed to expire points")
+		return 500, err
+	}
+	//проверка дневного лимита переводов отправителя
+	if p.transferDailyLimit > 0 {
+		var sent float64
+		q = `SELECT COALESCE(SUM(amount), 0) FROM transfers
+			WHERE sender_id = $1 AND created_at >= date_trunc('day', current_timestamp)`
+		if err = tx.QueryRow(ctx, q, sender.ID).Scan(&sent); err != nil {
+			p.logger.LogErr(err, "Failure to select object from table")
+			return 500, err
+		}
+		if sent+t.Amount > p.transferDailyLimit+pointsEpsilon {
+			return 422, fmt.Errorf("daily transfer limit exceeded")
+		}
+	}
+	held, err := heldAmount(ctx, tx, sender.ID)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	//после перевода на счету должен остаться минимальный остаток, удержанные баллы не переводятся
+	if sender.Accrual.Current-held-t.Amount < p.transferMinBalance-pointsEpsilon {
+		return 402, fmt.Errorf("insufficient funds")
+	}
+	q = `INSERT INTO transfers (sender_id, recipient_id, amount, created_at)
+		VALUES ($1, $2, $3, current_timestamp) RETURNING id, created_at`
+	if err = tx.QueryRow(ctx, q, sender.ID, recipient.ID, t.Amount).Scan(&t.ID, &t.CreatedAt); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	reference := strconv.FormatInt(t.ID, 10)
+	//партии переходят получателю с прежним сроком действия, чтобы перевод не продлевал жизнь баллов
+	parts, err := consumeLots(ctx, tx, sender.ID, t.Amount, storage.LedgerTransfer, reference)
+	if err != nil {
+		p.logger.LogErr(err, "failed to consume points")
+		return 500, err
+	}
+	moved := 0.0
+	for _, part := range parts {
+		if err = insertLot(ctx, tx, recipient.ID, storage.LedgerTransfer, reference, part.amount, part.expiresAt); err != nil {
+			p.logger.LogErr(err, "failed to add points")
+			return 500, err
+		}
+		moved += part.amount
+	}
+	//остаток баланса, не покрытый партиями, зачисляется бессрочно
+	if t.Amount-moved > pointsEpsilon {
+		if err = insertLot(ctx, tx, recipient.ID, storage.LedgerTransfer, reference, t.Amount-moved, nil); err != nil {
+			p.logger.LogErr(err, "failed to add points")
+			return 500, err
+		}
+	}
+	if err = p.repayDebt(ctx, tx, recipient.ID); err != nil {
+		p.logger.LogErr(err, "failed to repay clawback debt")
+		return 500, err
+	}
+	q = `UPDATE users SET balance_current = balance_current + $1 WHERE id = $2`
+	if _, err = tx.Exec(ctx, q, -t.Amount, sender.ID); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if _, err = tx.Exec(ctx, q, t.Amount, recipient.ID); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	//событие адресуется каждой стороне, чтобы перевод дошел до вебхуков и потоков обоих пользователей
+	for _, userID := range []int{sender.ID, recipient.ID} {
+		err = insertEvent(ctx, tx, events.TypeBalanceTransferred, reference, events.BalanceTransferred{
+			UserID:      userID,
+			TransferID:  t.ID,
+			SenderID:    sender.ID,
+			RecipientID: recipient.ID,
+			Amount:      t.Amount,
+		})
+		if err != nil {
+			p.logger.LogErr(err, "failed to insert event")
+			return 500, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		p.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	t.From = login
+	t.Direction = storage.TransferOut
+	return 200, nil
+}
+
+// Transfers возвращает входящие и исходящие переводы пользователя, новые — первыми.
+func (p *PGSStore) Transfers(ctx context.Context, login string) (int, []storage.Transfer, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.Transfers", trace.WithAttributes(
+		attribute.String(tracing.AttrUserLogin, login),
+	))
+	defer span.End()
+	q := `SELECT t.id, s.login, r.login, t.amount, CASE WHEN s.login = $1 THEN $2 ELSE $3 END, t.created_at
+		FROM transfers t JOIN users s ON s.id = t.sender_id JOIN users r ON r.id = t.recipient_id
+		WHERE s.login = $1 OR r.login = $1 ORDER BY t.created_at DESC, t.id DESC`
+	rows, err := p.replica.Query(ctx, q, login, storage.TransferOut, storage.TransferIn)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var transfers []storage.Transfer
+	for rows.Next() {
+		var t storage.Transfer
+		if err = rows.Scan(&t.ID, &t.From, &t.To, &t.Amount, &t.Direction, &t.CreatedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	if err = rows.Err(); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if len(transfers) == 0 {
+		return 204, nil, fmt.Errorf("no one transfer")
+	}
+	return 200, transfers, nil
+}
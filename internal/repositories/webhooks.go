@@ -0,0 +1,290 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/webhooks"
+)
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+
+	webhookDeliveriesLimit = 100
+)
+
+// webhookOwner возвращает id пользователя для фильтра по владельцу подписки.
+// Для пустого логина (администратор) возвращается nil, что соответствует глобальным подпискам.
+func (p *PGSStore) webhookOwner(ctx context.Context, login string) (*int64, int, error) {
+	if login == "" {
+		return nil, 200, nil
+	}
+	var id int64
+	q := `SELECT users.id FROM users WHERE login = $1`
+	if err := p.client.QueryRow(ctx, q, login).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			p.logger.LogErr(err, "Failure to select object from table")
+			return nil, 400, fmt.Errorf("wrong login %s", login)
+		}
+		p.logger.LogErr(err, "")
+		return nil, 500, err
+	}
+	return &id, 200, nil
+}
+
+func (p *PGSStore) CreateWebhook(ctx context.Context, login string, w *storage.WebhookSubscription) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.CreateWebhook")
+	defer span.End()
+	//проверка адреса и типов событий подписки; адрес во внутренней сети не принимается
+	if err := webhooks.ValidateURL(ctx, w.URL); err != nil {
+		return 400, err
+	}
+	if len(w.EventTypes) == 0 {
+		return 400, fmt.Errorf("event types are empty")
+	}
+	for _, t := range w.EventTypes {
+		if !events.IsKnownType(t) {
+			return 400, fmt.Errorf("unknown event type %s", t)
+		}
+	}
+	owner, statusCode, err := p.webhookOwner(ctx, login)
+	if err != nil {
+		return statusCode, err
+	}
+	//если секрет не задан, то генерируем его
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			return 500, err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	w.Global = owner == nil
+	q := `INSERT INTO webhook_subscriptions (user_id, url, secret, event_types, created_at)
+			VALUES ($1, $2, $3, $4, current_timestamp) RETURNING id, created_at`
+	if err = p.client.QueryRow(ctx, q, owner, w.URL, w.Secret, w.EventTypes).Scan(&w.ID, &w.CreatedAt); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	return 201, nil
+}
+
+func (p *PGSStore) GetWebhooks(ctx context.Context, login string) (int, []storage.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetWebhooks")
+	defer span.End()
+	owner, statusCode, err := p.webhookOwner(ctx, login)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	q := `SELECT id, user_id IS NULL, url, event_types, created_at FROM webhook_subscriptions
+			WHERE user_id IS NOT DISTINCT FROM $1 ORDER BY id`
+	rows, err := p.client.Query(ctx, q, owner)
+	if err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var subscriptions []storage.WebhookSubscription
+	for rows.Next() {
+		var w storage.WebhookSubscription
+		if err = rows.Scan(&w.ID, &w.Global, &w.URL, &w.EventTypes, &w.CreatedAt); err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		subscriptions = append(subscriptions, w)
+	}
+	if len(subscriptions) == 0 {
+		return 204, nil, fmt.Errorf("no one webhook")
+	}
+	return 200, subscriptions, nil
+}
+
+func (p *PGSStore) DeleteWebhook(ctx context.Context, login string, id int64) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.DeleteWebhook")
+	defer span.End()
+	owner, statusCode, err := p.webhookOwner(ctx, login)
+	if err != nil {
+		return statusCode, err
+	}
+	q := `DELETE FROM webhook_subscriptions WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2`
+	tag, err := p.client.Exec(ctx, q, id, owner)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to delete object from table")
+		return 500, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 404, fmt.Errorf("webhook %d not found", id)
+	}
+	return 200, nil
+}
+
+func (p *PGSStore) GetWebhookDeliveries(ctx context.Context, login string, id int64) (int, []storage.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.GetWebhookDeliveries")
+	defer span.End()
+	owner, statusCode, err := p.webhookOwner(ctx, login)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	var exists bool
+	q := `SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2)`
+	if err = p.client.QueryRow(ctx, q, id, owner).Scan(&exists); err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	if !exists {
+		return 404, nil, fmt.Errorf("webhook %d not found", id)
+	}
+	q = `SELECT id, subscription_id, event_id, event_type, payload, status, attempts, COALESCE(response_code, 0),
+			COALESCE(last_error, ''), next_attempt_at, delivered_at, created_at
+		FROM webhook_deliveries WHERE subscription_id = $1 ORDER BY id DESC LIMIT $2`
+	rows, err := p.client.Query(ctx, q, id, webhookDeliveriesLimit)
+	if err != nil {
+		p.logger.LogErr(err, "")
+		return 500, nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to scan object from table")
+		return 500, nil, err
+	}
+	if len(deliveries) == 0 {
+		return 204, nil, fmt.Errorf("no one delivery")
+	}
+	return 200, deliveries, nil
+}
+
+func (p *PGSStore) ReplayWebhookDelivery(ctx context.Context, login string, id int64) (int, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ReplayWebhookDelivery")
+	defer span.End()
+	owner, statusCode, err := p.webhookOwner(ctx, login)
+	if err != nil {
+		return statusCode, err
+	}
+	//повторная отправка начинается заново, с обнулением счетчика попыток
+	q := `UPDATE webhook_deliveries SET status = $3, attempts = 0, next_attempt_at = current_timestamp
+		WHERE id = $1 AND subscription_id IN (
+			SELECT id FROM webhook_subscriptions WHERE user_id IS NOT DISTINCT FROM $2
+		)`
+	tag, err := p.client.Exec(ctx, q, id, owner, WebhookPending)
+	if err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 404, fmt.Errorf("delivery %d not found", id)
+	}
+	return 202, nil
+}
+
+// EnqueueWebhookDeliveries создает доставки события для всех подходящих подписок:
+// глобальных и подписок пользователя, к которому относится событие.
+// Повторная обработка того же события не создает дублей.
+func (p *PGSStore) EnqueueWebhookDeliveries(ctx context.Context, e events.Event) error {
+	userID, err := e.UserID()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	q := `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		SELECT id, $1, $2, $3, $4, current_timestamp, current_timestamp FROM webhook_subscriptions
+		WHERE $2 = ANY(event_types) AND (user_id IS NULL OR user_id = $5)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	if _, err = p.client.Exec(ctx, q, e.ID, e.Type, payload, WebhookPending, userID); err != nil {
+		p.logger.LogErr(err, "Failure to insert object into table")
+		return err
+	}
+	return nil
+}
+
+func (p *PGSStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storage.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "PGSStore.ClaimWebhookDeliveries")
+	defer span.End()
+	q := `WITH claimed AS (
+			UPDATE webhook_deliveries SET next_attempt_at = current_timestamp + $3 * interval '1 millisecond'
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = $2 AND next_attempt_at <= current_timestamp
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT c.id, c.subscription_id, c.event_id, c.event_type, c.payload, c.status, c.attempts,
+			COALESCE(c.response_code, 0), COALESCE(c.last_error, ''), c.next_attempt_at, c.delivered_at, c.created_at,
+			s.url, s.secret
+		FROM claimed c JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		ORDER BY c.id`
+	rows, err := p.client.Query(ctx, q, limit, WebhookPending, lease.Milliseconds())
+	if err != nil {
+		p.logger.LogErr(err, "Failure to select object from table")
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []storage.WebhookDelivery
+	for rows.Next() {
+		var d storage.WebhookDelivery
+		err = rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			p.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (p *PGSStore) CompleteWebhookDelivery(ctx context.Context, id int64, responseCode int) error {
+	q := `UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, response_code = $3,
+			last_error = NULL, delivered_at = current_timestamp
+		WHERE id = $1`
+	if _, err := p.client.Exec(ctx, q, id, WebhookDelivered, responseCode); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	return nil
+}
+
+func (p *PGSStore) FailWebhookDelivery(ctx context.Context, id int64, responseCode int, cause error, maxAttempts int) error {
+	//после maxAttempts попыток доставка считается неудачной и ждет ручного повтора,
+	//до этого задержка удваивается с каждой попыткой: 10с, 20с, 40с ... но не больше часа
+	q := `UPDATE webhook_deliveries SET attempts = attempts + 1, response_code = NULLIF($2, 0), last_error = $3,
+			status = CASE WHEN attempts + 1 >= $4 THEN $5 ELSE status END,
+			next_attempt_at = current_timestamp + LEAST(interval '1 hour', interval '10 seconds' * power(2, LEAST(attempts, 9)))
+		WHERE id = $1`
+	if _, err := p.client.Exec(ctx, q, id, responseCode, cause.Error(), maxAttempts, WebhookFailed); err != nil {
+		p.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	return nil
+}
+
+func scanWebhookDeliveries(rows pgx.Rows) ([]storage.WebhookDelivery, error) {
+	defer rows.Close()
+	var deliveries []storage.WebhookDelivery
+	for rows.Next() {
+		var d storage.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
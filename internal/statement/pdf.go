@@ -0,0 +1,166 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+const (
+	//размер страницы A4 в пунктах
+	pageWidth  = 595
+	pageHeight = 842
+	pageMargin = 40
+	fontSize   = 9
+	lineHeight = 12
+	//число строк на странице
+	linesPerPage = (pageHeight - 2*pageMargin) / lineHeight
+
+	//номера объектов, которые записываются в конце документа или не зависят от числа страниц
+	catalogObject = 1
+	pagesObject   = 2
+	fontObject    = 3
+)
+
+// pdfWriter пишет выписку простым PDF моноширинным шрифтом. Каждая страница записывается
+// сразу после заполнения, в памяти хранятся только строки текущей страницы и смещения объектов.
+type pdfWriter struct {
+	balance
+	w       *countingWriter
+	h       Header
+	lines   []string
+	offsets map[int]int64
+	pages   []int
+	next    int
+	err     error
+}
+
+func newPDFWriter(w io.Writer, h Header) *pdfWriter {
+	return &pdfWriter{
+		w:       &countingWriter{w: w},
+		h:       h,
+		offsets: make(map[int]int64),
+		next:    fontObject + 1,
+	}
+}
+
+func (p *pdfWriter) ContentType() string {
+	return "application/pdf"
+}
+
+func (p *pdfWriter) Begin(opening float64) error {
+	p.begin(opening)
+	p.printf("%%PDF-1.4\n")
+	p.object(fontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	p.line("Statement for %s", p.h.Login)
+	p.line("Period: %s - %s", p.h.From.Format(time.RFC3339), p.h.To.Format(time.RFC3339))
+	p.line("Opening balance: %.2f", opening)
+	p.line("")
+	p.line("%-25s %-10s %-20s %12s %12s", "date", "kind", "reference", "amount", "balance")
+	return p.err
+}
+
+func (p *pdfWriter) Entry(e storage.StatementEntry) error {
+	p.apply(&e)
+	p.line("%-25s %-10s %-20s %12.2f %12.2f", e.Date.Format(time.RFC3339), e.Kind, e.Reference, e.Amount, e.Balance)
+	return p.err
+}
+
+func (p *pdfWriter) End() error {
+	p.line("")
+	p.line("Closing balance: %.2f", p.current)
+	p.flushPage()
+	kids := make([]string, len(p.pages))
+	for i, id := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	p.object(pagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	p.object(catalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject))
+	//таблица смещений объектов, каждая запись ровно 20 байт
+	xref := p.w.n
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", p.next)
+	for id := 1; id < p.next; id++ {
+		p.printf("%010d 00000 n \n", p.offsets[id])
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.next, catalogObject, xref)
+	return p.err
+}
+
+// line добавляет строку на текущую страницу и записывает страницу, когда она заполнена.
+func (p *pdfWriter) line(format string, args ...interface{}) {
+	p.lines = append(p.lines, fmt.Sprintf(format, args...))
+	if len(p.lines) == linesPerPage {
+		p.flushPage()
+	}
+}
+
+func (p *pdfWriter) flushPage() {
+	if len(p.lines) == 0 {
+		return
+	}
+	var content strings.Builder
+	fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, lineHeight, pageMargin, pageHeight-pageMargin)
+	for _, l := range p.lines {
+		fmt.Fprintf(&content, "(%s) Tj T*\n", escapePDF(l))
+	}
+	content.WriteString("ET")
+	p.lines = p.lines[:0]
+
+	contentID := p.reserve()
+	p.object(contentID, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	pageID := p.reserve()
+	p.object(pageID, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] "+
+		"/Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+		pagesObject, pageWidth, pageHeight, fontObject, contentID))
+	p.pages = append(p.pages, pageID)
+}
+
+func (p *pdfWriter) reserve() int {
+	id := p.next
+	p.next++
+	return id
+}
+
+func (p *pdfWriter) object(id int, body string) {
+	p.offsets[id] = p.w.n
+	p.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// escapePDF экранирует строку для PDF; символы вне ASCII стандартный шрифт не содержит.
+func escapePDF(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// countingWriter считает записанные байты для таблицы смещений PDF.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
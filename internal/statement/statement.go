@@ -0,0 +1,155 @@
+// Package statement формирует выписку по счету в форматах JSON, CSV и PDF. Операции
+// записываются по одной, поэтому выписка любой длины не загружается в память.
+package statement
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+// поддерживаемые форматы выписки
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatPDF  = "pdf"
+)
+
+// Header — реквизиты выписки.
+type Header struct {
+	Login string
+	From  time.Time
+	To    time.Time
+}
+
+// Writer записывает выписку: Begin и Entry вызывает хранилище, End — обработчик после
+// того, как все операции прочитаны.
+type Writer interface {
+	storage.StatementWriter
+	End() error
+	// Started сообщает, начата ли запись: после этого ответ с ошибкой отправить уже нельзя.
+	Started() bool
+	ContentType() string
+}
+
+// NewWriter возвращает Writer формата format, который пишет выписку в w.
+func NewWriter(format string, w io.Writer, h Header) (Writer, error) {
+	switch format {
+	case FormatJSON, "":
+		return &jsonWriter{w: w, h: h}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), h: h}, nil
+	case FormatPDF:
+		return newPDFWriter(w, h), nil
+	default:
+		return nil, fmt.Errorf("unknown statement format %s", format)
+	}
+}
+
+// balance считает остаток после каждой операции.
+type balance struct {
+	started bool
+	opening float64
+	current float64
+}
+
+func (b *balance) begin(opening float64) {
+	b.started = true
+	b.opening = opening
+	b.current = opening
+}
+
+func (b *balance) apply(e *storage.StatementEntry) {
+	b.current += e.Amount
+	e.Balance = b.current
+}
+
+func (b *balance) Started() bool {
+	return b.started
+}
+
+type jsonWriter struct {
+	balance
+	w     io.Writer
+	h     Header
+	first bool
+}
+
+func (j *jsonWriter) ContentType() string {
+	return "application/json"
+}
+
+func (j *jsonWriter) Begin(opening float64) error {
+	j.begin(opening)
+	j.first = true
+	login, err := json.Marshal(j.h.Login)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, `{"login":%s,"from":"%s","to":"%s","opening_balance":%s,"entries":[`,
+		login, j.h.From.Format(time.RFC3339), j.h.To.Format(time.RFC3339), formatFloat(opening))
+	return err
+}
+
+func (j *jsonWriter) Entry(e storage.StatementEntry) error {
+	j.apply(&e)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if !j.first {
+		if _, err = io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.first = false
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) End() error {
+	_, err := fmt.Fprintf(j.w, `],"closing_balance":%s}`, formatFloat(j.current))
+	return err
+}
+
+// csvWriter пишет операции строками date,kind,order,amount,balance; первая и последняя
+// строки содержат входящий и исходящий остатки.
+type csvWriter struct {
+	balance
+	w *csv.Writer
+	h Header
+}
+
+func (c *csvWriter) ContentType() string {
+	return "text/csv"
+}
+
+func (c *csvWriter) Begin(opening float64) error {
+	c.begin(opening)
+	if err := c.w.Write([]string{"date", "kind", "reference", "amount", "balance"}); err != nil {
+		return err
+	}
+	return c.w.Write([]string{c.h.From.Format(time.RFC3339), "opening_balance", "", "", formatFloat(opening)})
+}
+
+func (c *csvWriter) Entry(e storage.StatementEntry) error {
+	c.apply(&e)
+	return c.w.Write([]string{e.Date.Format(time.RFC3339), e.Kind, e.Reference, formatFloat(e.Amount), formatFloat(e.Balance)})
+}
+
+func (c *csvWriter) End() error {
+	if err := c.w.Write([]string{c.h.To.Format(time.RFC3339), "closing_balance", "", "", formatFloat(c.current)}); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
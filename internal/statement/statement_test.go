@@ -0,0 +1,120 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+var (
+	testHeader = Header{
+		Login: "test",
+		From:  time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	testEntries = []storage.StatementEntry{
+		{Date: time.Date(2026, 9, 3, 10, 0, 0, 0, time.UTC), Kind: storage.LedgerAccrual, Reference: "12345678903", Amount: 500},
+		{Date: time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC), Kind: storage.LedgerWithdrawal, Reference: "2377225624", Amount: -120.5},
+	}
+)
+
+func writeStatement(t *testing.T, format string, entries []storage.StatementEntry) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, testHeader)
+	assert.NoError(t, err)
+	assert.False(t, w.Started())
+	assert.NoError(t, w.Begin(100))
+	assert.True(t, w.Started())
+	for _, e := range entries {
+		assert.NoError(t, w.Entry(e))
+	}
+	assert.NoError(t, w.End())
+	return buf.String()
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter("xml", &bytes.Buffer{}, testHeader)
+	assert.Error(t, err)
+}
+
+func TestJSONWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []storage.StatementEntry
+		closing float64
+	}{
+		{name: "entries", entries: testEntries, closing: 479.5},
+		{name: "empty", entries: nil, closing: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result struct {
+				Login   string                   `json:"login"`
+				Opening float64                  `json:"opening_balance"`
+				Entries []storage.StatementEntry `json:"entries"`
+				Closing float64                  `json:"closing_balance"`
+			}
+			assert.NoError(t, json.Unmarshal([]byte(writeStatement(t, FormatJSON, tt.entries)), &result))
+			assert.Equal(t, "test", result.Login)
+			assert.Equal(t, 100.0, result.Opening)
+			assert.Len(t, result.Entries, len(tt.entries))
+			assert.Equal(t, tt.closing, result.Closing)
+		})
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(writeStatement(t, FormatCSV, testEntries))).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"date", "kind", "reference", "amount", "balance"},
+		{"2026-09-01T00:00:00Z", "opening_balance", "", "", "100"},
+		{"2026-09-03T10:00:00Z", "accrual", "12345678903", "500", "600"},
+		{"2026-09-10T12:00:00Z", "withdrawal", "2377225624", "-120.5", "479.5"},
+		{"2026-10-01T00:00:00Z", "closing_balance", "", "", "479.5"},
+	}, records)
+}
+
+func TestPDFWriter(t *testing.T) {
+	//операций больше, чем помещается на одну страницу
+	var entries []storage.StatementEntry
+	for i := 0; i < 2*linesPerPage; i++ {
+		entries = append(entries, storage.StatementEntry{Date: testHeader.From, Kind: storage.LedgerAccrual,
+			Reference: strconv.Itoa(i), Amount: 1})
+	}
+	doc := writeStatement(t, FormatPDF, entries)
+	assert.True(t, strings.HasPrefix(doc, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(doc, "%%EOF\n"))
+	assert.Contains(t, doc, "/Count 3")
+	assert.Contains(t, doc, "(Closing balance: 226.00)")
+
+	//смещения в таблице xref указывают на начало объектов
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	assert.Len(t, startxref, 2)
+	offset, err := strconv.Atoi(startxref[1])
+	assert.NoError(t, err)
+	lines := strings.Split(doc[offset:], "\n")
+	assert.Equal(t, "xref", lines[0])
+	var size int
+	_, err = fmt.Sscanf(lines[1], "0 %d", &size)
+	assert.NoError(t, err)
+	for id := 1; id < size; id++ {
+		objOffset, err := strconv.Atoi(lines[2+id][:10])
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(doc[objOffset:], fmt.Sprintf("%d 0 obj\n", id)), "object %d", id)
+	}
+}
+
+func TestEscapePDF(t *testing.T) {
+	assert.Equal(t, `a\(b\)\\c?`, escapePDF(`a(b)\cж`))
+}
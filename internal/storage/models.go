@@ -1,6 +1,9 @@
 package storage
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
 	ID             int      `json:"ID"`
@@ -17,11 +20,41 @@ type Orders struct {
 	Accrual    float64   `json:"accrual"`
 	Sum        float64   `json:"sum"`
 	UploadedAt time.Time `json:"uploaded_at"`
+	//сведения о проверках в системе начислений, заполняются только для поддержки
+	Attempts      int        `json:"attempts,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+}
+
+// источники смены статуса заказа в истории
+const (
+	SourceUser   = "user"
+	SourceAgent  = "agent"
+	SourcePush   = "push"
+	SourceAdmin  = "admin"
+	SourceSystem = "system"
+	SourceImport = "import"
+)
+
+type OrderStatusChange struct {
+	OldStatus string    `json:"old_status,omitempty"`
+	Status    string    `json:"status"`
+	Accrual   float64   `json:"accrual"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrderDetail — заказ вместе с историей смены его статусов и списаниями по этому номеру.
+type OrderDetail struct {
+	Orders
+	History     []OrderStatusChange `json:"history"`
+	Withdrawals []Order             `json:"withdrawals"`
 }
 
 type Order struct {
 	Order       string    `json:"order"`
 	Sum         float64   `json:"sum"`
+	Total       float64   `json:"order_total,omitempty"`
+	Refunded    float64   `json:"refunded,omitempty"`
 	ProcessedAt time.Time `json:"processed_at"`
 }
 
@@ -33,4 +66,185 @@ type AcceptUser struct {
 type Balance struct {
 	Current   float64
 	Withdrawn float64
+	//уровень программы лояльности
+	Tier string `json:"tier,omitempty"`
+	//непогашенная часть отмененных начислений
+	Debt float64 `json:"debt,omitempty"`
+	//баллы, зарезервированные удержаниями, и доступный для списания остаток
+	Held      float64 `json:"held"`
+	Available float64 `json:"available"`
+	//баллы, срок действия которых истекает в ближайшее время
+	ExpiringSoon []ExpiringPoints `json:"expiring_soon,omitempty"`
+}
+
+type ExpiringPoints struct {
+	Amount    float64   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TierChange — запись истории смены уровня лояльности.
+type TierChange struct {
+	OldTier       string    `json:"old_tier"`
+	Tier          string    `json:"tier"`
+	RollingPoints float64   `json:"rolling_points"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Campaign — бонусная кампания с промокодом. Нулевой MaxRedemptions означает
+// отсутствие общего лимита погашений.
+type Campaign struct {
+	ID             int64      `json:"id"`
+	Code           string     `json:"code"`
+	Bonus          float64    `json:"bonus"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxRedemptions int        `json:"max_redemptions"`
+	PerUserLimit   int        `json:"per_user_limit"`
+	Redemptions    int        `json:"redemptions"`
+	RedeemedPoints float64    `json:"redeemed_points"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// PromoRedemption — погашение промокода пользователем.
+type PromoRedemption struct {
+	CampaignID int64     `json:"campaign_id"`
+	Code       string    `json:"code"`
+	UserID     int       `json:"user_id,omitempty"`
+	Bonus      float64   `json:"bonus"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// направления перевода баллов относительно пользователя
+const (
+	TransferIn  = "in"
+	TransferOut = "out"
+)
+
+// ImportUser — пользователь из файла миграции. Хэш пароля переносится без изменений.
+type ImportUser struct {
+	Line           int64
+	Login          string
+	HashedPassword string
+	Current        float64
+	Withdrawn      float64
+}
+
+// ImportOrder — заказ из файла миграции.
+type ImportOrder struct {
+	Line       int64
+	Login      string
+	Number     string
+	Status     string
+	Accrual    float64
+	UploadedAt time.Time
+}
+
+// ImportRejection — строка файла миграции, которая не была загружена.
+type ImportRejection struct {
+	Line   int64
+	Reason string
+}
+
+// виды записей в журнале движения баллов, они же виды операций в выписке по счету
+const (
+	LedgerAccrual    = "accrual"
+	LedgerWithdrawal = "withdrawal"
+	LedgerExpiry     = "expiry"
+	LedgerPromo      = "promo"
+	LedgerTransfer   = "transfer"
+	LedgerRefund     = "refund"
+	LedgerClawback   = "clawback"
+	LedgerImport     = "import"
+	//баланс, перенесенный в партии при переходе на партии баллов
+	LedgerMigration = "migration"
+)
+
+// StatementEntry — операция выписки по счету. Reference — основание операции: номер заказа,
+// перевода или код кампании. Amount списаний отрицательный, Balance — остаток после операции.
+type StatementEntry struct {
+	Date      time.Time `json:"date"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference"`
+	Amount    float64   `json:"amount"`
+	Balance   float64   `json:"balance"`
+}
+
+// StatementWriter получает выписку по мере чтения из базы: сначала входящий остаток,
+// затем операции в хронологическом порядке.
+type StatementWriter interface {
+	Begin(opening float64) error
+	Entry(e StatementEntry) error
+}
+
+// Transfer — перевод баллов между пользователями.
+type Transfer struct {
+	ID        int64     `json:"id"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Amount    float64   `json:"amount"`
+	Direction string    `json:"direction,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Refund — возврат баллов по списанию Order. Нулевая сумма в запросе означает
+// возврат всего, что еще не возвращено.
+type Refund struct {
+	ID        int64     `json:"id"`
+	Order     string    `json:"order"`
+	Sum       float64   `json:"sum"`
+	Reason    string    `json:"reason,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Hold — удержание баллов под заказ до его оплаты.
+type Hold struct {
+	ID        int64     `json:"id"`
+	Order     string    `json:"order"`
+	Sum       float64   `json:"sum"`
+	Total     float64   `json:"order_total,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Clawback — отмена начисления по заказу, возвращенному в магазин.
+type Clawback struct {
+	Order   string  `json:"order"`
+	Amount  float64 `json:"amount"`
+	Current float64 `json:"current"`
+	Debt    float64 `json:"debt"`
+}
+
+// PointsExpiry — строка отчета о сгорании баллов пользователя.
+type PointsExpiry struct {
+	UserID int     `json:"user_id"`
+	Amount float64 `json:"amount"`
+	Lots   int     `json:"lots"`
+}
+
+type WebhookSubscription struct {
+	ID         int64     `json:"id"`
+	Global     bool      `json:"global"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseCode   int             `json:"response_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	URL            string          `json:"-"`
+	Secret         string          `json:"-"`
 }
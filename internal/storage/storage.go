@@ -1,14 +1,53 @@
 package storage
 
+import (
+	"context"
+	"time"
+)
+
 type Storage interface {
-	Register(u *AcceptUser) error
-	Login(u *AcceptUser) error
-	GetOrder(login string) (int, []Orders, error)
-	CollectOrder(login string, order string) (int, error)
-	GetBalance(login string) (*Balance, error)
-	GetAllOrders() ([]Orders, error)
-	UpdateOrders([]Orders) error
-	UpdateUserBalance([]Orders) error
-	Withdraw(login string, order *Order) (int, error)
-	Withdrawals(login string) (int, []Order, error)
+	Register(ctx context.Context, u *AcceptUser) error
+	Login(ctx context.Context, u *AcceptUser) error
+	GetOrder(ctx context.Context, login string) (int, []Orders, error)
+	CollectOrder(ctx context.Context, login string, order string) (int, error)
+	GetBalance(ctx context.Context, login string) (*Balance, error)
+	UpdateOrders(ctx context.Context, source string, orders []Orders) ([]Orders, error)
+	GetOrderDetail(ctx context.Context, login string, number string) (int, *OrderDetail, error)
+	CancelOrder(ctx context.Context, login string, number string) (int, error)
+	Clawback(ctx context.Context, source string, c *Clawback) (int, error)
+	// методы расписания проверок заказов в системе начислений
+	ClaimOrders(ctx context.Context, workerID string, limit int, lease time.Duration) ([]Orders, error)
+	ReleaseOrders(ctx context.Context, workerID string, numbers []string) error
+	RescheduleOrders(ctx context.Context, numbers []string) error
+	FailStaleOrders(ctx context.Context, maxAge time.Duration) (int, error)
+	GetFailedOrders(ctx context.Context) (int, []Orders, error)
+	Withdraw(ctx context.Context, login string, order *Order) (int, error)
+	Withdrawals(ctx context.Context, login string) (int, []Order, error)
+	// Statement передает в w выписку за период [from, to) без загрузки ее целиком в память
+	Statement(ctx context.Context, login string, from, to time.Time, w StatementWriter) (int, error)
+	// методы двухфазного списания: удержание, подтверждение и снятие
+	CreateHold(ctx context.Context, login string, h *Hold) (int, error)
+	GetHolds(ctx context.Context, login string) (int, []Hold, error)
+	CaptureHold(ctx context.Context, login string, id int64) (int, *Hold, error)
+	ReleaseHold(ctx context.Context, login string, id int64) (int, error)
+	ExpireHolds(ctx context.Context) (int, error)
+	Transfer(ctx context.Context, login string, t *Transfer) (int, error)
+	RefundWithdrawal(ctx context.Context, source string, r *Refund) (int, error)
+	GetRefunds(ctx context.Context, order string) (int, []Refund, error)
+	Transfers(ctx context.Context, login string) (int, []Transfer, error)
+	GetUserID(ctx context.Context, login string) (int, error)
+	GetTierHistory(ctx context.Context, login string) (int, []TierChange, error)
+	// ExpirePoints списывает баллы с истекшим сроком действия; при dryRun только возвращает отчет
+	ExpirePoints(ctx context.Context, dryRun bool) ([]PointsExpiry, error)
+	// методы бонусных кампаний и промокодов
+	CreateCampaign(ctx context.Context, c *Campaign) (int, error)
+	GetCampaigns(ctx context.Context) (int, []Campaign, error)
+	GetCampaignRedemptions(ctx context.Context, id int64) (int, []PromoRedemption, error)
+	RedeemPromo(ctx context.Context, login string, code string) (int, *PromoRedemption, error)
+	// методы подписок на вебхуки; пустой login означает глобальные подписки администратора
+	CreateWebhook(ctx context.Context, login string, w *WebhookSubscription) (int, error)
+	GetWebhooks(ctx context.Context, login string) (int, []WebhookSubscription, error)
+	DeleteWebhook(ctx context.Context, login string, id int64) (int, error)
+	GetWebhookDeliveries(ctx context.Context, login string, id int64) (int, []WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, login string, id int64) (int, error)
 }
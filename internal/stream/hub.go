@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+)
+
+const subscriberBuffer = 64
+
+type subscriber struct {
+	userID int
+	ch     chan events.Event
+}
+
+// Hub раздает события подключенным клиентам по пользователям и хранит ограниченную
+// историю последних событий для продолжения потока по Last-Event-ID.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[*subscriber]struct{}
+	history     []events.Event
+	seen        map[int64]struct{}
+	historySize int
+	closed      bool
+}
+
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		subscribers: make(map[int]map[*subscriber]struct{}),
+		seen:        make(map[int64]struct{}),
+		historySize: historySize,
+	}
+}
+
+// Publish сохраняет событие в истории и отправляет его подписчикам пользователя.
+// Повторно доставленные события (доставка at-least-once) отбрасываются.
+func (h *Hub) Publish(e events.Event) {
+	userID, err := e.UserID()
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	if _, ok := h.seen[e.ID]; ok {
+		return
+	}
+	h.history = append(h.history, e)
+	h.seen[e.ID] = struct{}{}
+	if len(h.history) > h.historySize {
+		delete(h.seen, h.history[0].ID)
+		h.history = h.history[1:]
+	}
+	for s := range h.subscribers[userID] {
+		select {
+		case s.ch <- e:
+		default:
+			//медленный клиент отключается, он переподключится с Last-Event-ID
+			h.remove(s)
+		}
+	}
+}
+
+// Subscribe подписывает клиента на события пользователя. Возвращает события из истории
+// с идентификатором больше lastEventID, канал новых событий и функцию отписки.
+// Канал закрывается при отписке, переполнении буфера и остановке хаба.
+func (h *Hub) Subscribe(userID int, lastEventID int64) ([]events.Event, <-chan events.Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &subscriber{userID: userID, ch: make(chan events.Event, subscriberBuffer)}
+	if h.closed {
+		close(s.ch)
+		return nil, s.ch, func() {}
+	}
+	var backlog []events.Event
+	if lastEventID > 0 {
+		for _, e := range h.history {
+			if e.ID <= lastEventID {
+				continue
+			}
+			if id, err := e.UserID(); err == nil && id == userID {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*subscriber]struct{})
+	}
+	h.subscribers[userID][s] = struct{}{}
+	return backlog, s.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(s)
+	}
+}
+
+// Close отключает всех клиентов, чтобы graceful shutdown не ждал открытых потоков.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subscribers {
+		for s := range subs {
+			h.remove(s)
+		}
+	}
+}
+
+func (h *Hub) remove(s *subscriber) {
+	subs, ok := h.subscribers[s.userID]
+	if !ok {
+		return
+	}
+	if _, ok = subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	close(s.ch)
+	if len(subs) == 0 {
+		delete(h.subscribers, s.userID)
+	}
+}
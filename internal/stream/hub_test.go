@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+)
+
+func newEvent(t *testing.T, id int64, userID int) events.Event {
+	e, err := events.NewEvent(events.TypeOrderStatusChanged, "12345678903", events.OrderStatusChanged{
+		UserID: userID,
+		Order:  "12345678903",
+		Status: "PROCESSING",
+	})
+	assert.NoError(t, err)
+	e.ID = id
+	return e
+}
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	h := NewHub(10)
+	_, ch, unsubscribe := h.Subscribe(1, 0)
+	defer unsubscribe()
+
+	h.Publish(newEvent(t, 1, 1))
+	h.Publish(newEvent(t, 2, 2))
+	//повторная доставка того же события отбрасывается
+	h.Publish(newEvent(t, 1, 1))
+	h.Publish(newEvent(t, 3, 1))
+
+	assert.Equal(t, int64(1), (<-ch).ID)
+	assert.Equal(t, int64(3), (<-ch).ID)
+	assert.Len(t, ch, 0)
+}
+
+func TestHub_Resume(t *testing.T) {
+	h := NewHub(3)
+	for i := int64(1); i <= 5; i++ {
+		h.Publish(newEvent(t, i, 1))
+	}
+	h.Publish(newEvent(t, 6, 2))
+
+	//в истории остались только события 4, 5 и 6
+	backlog, _, unsubscribe := h.Subscribe(1, 1)
+	defer unsubscribe()
+	if assert.Len(t, backlog, 2) {
+		assert.Equal(t, int64(4), backlog[0].ID)
+		assert.Equal(t, int64(5), backlog[1].ID)
+	}
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	h := NewHub(subscriberBuffer * 2)
+	_, ch, unsubscribe := h.Subscribe(1, 0)
+	defer unsubscribe()
+	for i := int64(1); i <= subscriberBuffer+1; i++ {
+		h.Publish(newEvent(t, i, 1))
+	}
+	received := 0
+	for range ch {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+}
+
+func TestHub_Close(t *testing.T) {
+	h := NewHub(10)
+	_, ch, _ := h.Subscribe(1, 0)
+	h.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	_, ch, _ = h.Subscribe(1, 0)
+	_, ok = <-ch
+	assert.False(t, ok)
+}
+
+func TestHub_TransferReachesBothUsers(t *testing.T) {
+	h := NewHub(10)
+	_, senderCh, unsubscribeSender := h.Subscribe(1, 0)
+	defer unsubscribeSender()
+	_, recipientCh, unsubscribeRecipient := h.Subscribe(2, 0)
+	defer unsubscribeRecipient()
+
+	//перевод пишется отдельным событием для каждой стороны
+	for i, userID := range []int{1, 2} {
+		e, err := events.NewEvent(events.TypeBalanceTransferred, "1", events.BalanceTransferred{
+			UserID:      userID,
+			TransferID:  1,
+			SenderID:    1,
+			RecipientID: 2,
+			Amount:      100,
+		})
+		assert.NoError(t, err)
+		e.ID = int64(i + 1)
+		h.Publish(e)
+	}
+
+	assert.Equal(t, int64(1), (<-senderCh).ID)
+	assert.Equal(t, int64(2), (<-recipientCh).ID)
+	assert.Len(t, senderCh, 0)
+	assert.Len(t, recipientCh, 0)
+}
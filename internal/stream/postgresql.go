@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/pkg/client/postgresql"
+)
+
+// Channel — канал PostgreSQL, через который события расходятся по всем экземплярам сервиса.
+const Channel = "gophermart_events"
+
+const reconnectDelay = time.Second
+
+// Notifier публикует события через NOTIFY. Каждое событие ретранслятор outbox отдает
+// только одному экземпляру сервиса, поэтому без NOTIFY клиенты остальных его бы не увидели.
+type Notifier struct {
+	client postgresql.Client
+}
+
+func NewNotifier(client postgresql.Client) *Notifier {
+	return &Notifier{client: client}
+}
+
+func (n *Notifier) Publish(ctx context.Context, e events.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = n.client.Exec(ctx, `SELECT pg_notify($1, $2)`, Channel, string(payload))
+	return err
+}
+
+// Listen слушает канал событий на выделенном соединении и передает события в хаб.
+// При обрыве соединения переподключается, пока не отменен ctx.
+func Listen(ctx context.Context, pool *pgxpool.Pool, hub *Hub, logger loggers.Logger) {
+	for ctx.Err() == nil {
+		if err := listen(ctx, pool, hub); err != nil && ctx.Err() == nil {
+			logger.LogErr(err, "failed to listen events channel")
+			select {
+			case <-ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}
+}
+
+func listen(ctx context.Context, pool *pgxpool.Pool, hub *Hub) error {
+	poolConn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	//соединение в режиме LISTEN забирается из пула и закрывается после использования
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var e events.Event
+		if err = json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			continue
+		}
+		hub.Publish(e)
+	}
+}
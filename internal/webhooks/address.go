@@ -0,0 +1,97 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// deniedPrefixes — диапазоны, которые не покрывают методы net.IP, но тоже ведут
+// во внутреннюю сеть или к шлюзам трансляции адресов.
+var deniedPrefixes = []netip.Prefix{
+	//"эта" сеть
+	netip.MustParsePrefix("0.0.0.0/8"),
+	//shared address space провайдерского NAT
+	netip.MustParsePrefix("100.64.0.0/10"),
+	//зарезервированные адреса и широковещательный 255.255.255.255
+	netip.MustParsePrefix("240.0.0.0/4"),
+	//NAT64: шлюз транслирует такие адреса в любые IPv4, в том числе внутренние
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// CheckIP запрещает доставку на адреса внутренней сети: loopback, частные, link-local
+// (в том числе адрес метаданных облака 169.254.169.254), multicast, неуказанные адреса
+// и диапазоны из deniedPrefixes.
+func CheckIP(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("webhook address %s is not public", ip)
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return fmt.Errorf("webhook address %s is not an IP", ip)
+	}
+	//IPv4-mapped адреса сверяем с IPv4-диапазонами
+	addr = addr.Unmap()
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("webhook address %s is not public", ip)
+		}
+	}
+	return nil
+}
+
+// ValidateURL проверяет адрес подписки: схему http или https и то, что все адреса,
+// в которые разрешается хост, публичные.
+func ValidateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("wrong webhook url %s", rawURL)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if err = CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newClient создает HTTP-клиент, который проверяет адрес при каждом подключении: запись DNS
+// могла измениться после создания подписки, а перенаправление — вести во внутреннюю сеть.
+// Прокси из окружения не используется, иначе проверялся бы адрес прокси, а не получателя.
+func newClient(check func(net.IP) error) http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("webhook address %s is not an IP", host)
+			}
+			return check(ip)
+		},
+	}
+	return http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+const (
+	HeaderEvent     = "X-Gophermart-Event"
+	HeaderDelivery  = "X-Gophermart-Delivery"
+	HeaderTimestamp = "X-Gophermart-Timestamp"
+	HeaderSignature = "X-Gophermart-Signature"
+
+	batchSize      = 50
+	requestTimeout = 10 * time.Second
+	//доставки пачки отправляются по очереди, поэтому аренда должна пережить
+	//все запросы пачки с максимальным таймаутом, иначе их заберет другой экземпляр
+	deliveryLease = batchSize*requestTimeout + time.Minute
+	//после стольких неудачных попыток доставка ждет ручного повтора
+	MaxAttempts = 10
+)
+
+type Store interface {
+	EnqueueWebhookDeliveries(ctx context.Context, e events.Event) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storage.WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, id int64, responseCode int) error
+	FailWebhookDelivery(ctx context.Context, id int64, responseCode int, cause error, maxAttempts int) error
+}
+
+// Dispatcher подписывается на шину событий и ставит доставки в очередь для подходящих подписок.
+type Dispatcher struct {
+	store Store
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{store: store}
+}
+
+func (d *Dispatcher) Handle(ctx context.Context, e events.Event) error {
+	return d.store.EnqueueWebhookDeliveries(ctx, e)
+}
+
+// Worker отправляет доставки подписчикам и фиксирует результат каждой попытки.
+type Worker struct {
+	store  Store
+	logger loggers.Logger
+	client http.Client
+}
+
+func NewWorker(store Store, logger loggers.Logger) *Worker {
+	return &Worker{
+		store:  store,
+		logger: logger,
+		client: newClient(CheckIP),
+	}
+}
+
+func (w *Worker) Start(ticker time.Ticker) {
+	for range ticker.C {
+		w.Flush(context.Background())
+	}
+}
+
+// Flush отправляет все доставки, срок которых наступил.
+func (w *Worker) Flush(ctx context.Context) {
+	for {
+		deliveries, err := w.store.ClaimWebhookDeliveries(ctx, batchSize, deliveryLease)
+		if err != nil {
+			w.logger.LogErr(err, "failed to claim webhook deliveries")
+			return
+		}
+		for _, d := range deliveries {
+			w.deliver(ctx, d)
+		}
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+func (w *Worker) deliver(ctx context.Context, d storage.WebhookDelivery) {
+	responseCode, err := w.send(ctx, d)
+	if err != nil {
+		w.logger.LogErr(err, "failed to deliver webhook "+strconv.FormatInt(d.ID, 10))
+		if err = w.store.FailWebhookDelivery(ctx, d.ID, responseCode, err, MaxAttempts); err != nil {
+			w.logger.LogErr(err, "failed to mark webhook delivery as failed")
+		}
+		return
+	}
+	if err = w.store.CompleteWebhookDelivery(ctx, d.ID, responseCode); err != nil {
+		w.logger.LogErr(err, "failed to mark webhook delivery as delivered")
+	}
+}
+
+func (w *Worker) send(ctx context.Context, d storage.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign подписывает тело запроса: HMAC-SHA256 от "<timestamp>.<body>" с секретом подписки.
+// Метка времени входит в подпись, чтобы получатель мог отклонять повторно отправленные старые запросы.
+func Sign(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/events"
+	"github.com/CyrilSbrodov/GopherAPIStore/internal/storage"
+)
+
+type fakeStore struct {
+	pending   []storage.WebhookDelivery
+	completed []int64
+	failed    []int64
+	enqueued  []events.Event
+}
+
+func (f *fakeStore) EnqueueWebhookDeliveries(ctx context.Context, e events.Event) error {
+	f.enqueued = append(f.enqueued, e)
+	return nil
+}
+
+func (f *fakeStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storage.WebhookDelivery, error) {
+	batch := f.pending
+	f.pending = nil
+	return batch, nil
+}
+
+func (f *fakeStore) CompleteWebhookDelivery(ctx context.Context, id int64, responseCode int) error {
+	f.completed = append(f.completed, id)
+	return nil
+}
+
+func (f *fakeStore) FailWebhookDelivery(ctx context.Context, id int64, responseCode int, cause error, maxAttempts int) error {
+	f.failed = append(f.failed, id)
+	return nil
+}
+
+func TestWorker_Flush(t *testing.T) {
+	payload := []byte(`{"id":1,"type":"order.processed"}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		expected := Sign("secret", r.Header.Get(HeaderTimestamp), body)
+		if r.Header.Get(HeaderSignature) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, events.TypeOrderProcessed, r.Header.Get(HeaderEvent))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{pending: []storage.WebhookDelivery{
+		{ID: 1, EventType: events.TypeOrderProcessed, Payload: payload, URL: srv.URL + "/ok", Secret: "secret"},
+		{ID: 2, EventType: events.TypeOrderProcessed, Payload: payload, URL: srv.URL + "/fail", Secret: "secret"},
+		{ID: 3, EventType: events.TypeOrderProcessed, Payload: payload, URL: srv.URL + "/ok", Secret: "wrong"},
+	}}
+	w := NewWorker(store, *loggers.NewLogger())
+	//тестовый сервер слушает loopback, поэтому проверка адреса отключается
+	w.client = newClient(func(net.IP) error { return nil })
+	w.Flush(context.Background())
+
+	assert.Equal(t, []int64{1}, store.completed)
+	assert.Equal(t, []int64{2, 3}, store.failed)
+}
+
+func TestWorker_FlushRejectsInternalAddress(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	//адрес мог стать внутренним уже после создания подписки
+	store := &fakeStore{pending: []storage.WebhookDelivery{
+		{ID: 1, EventType: events.TypeOrderProcessed, Payload: []byte(`{}`), URL: srv.URL, Secret: "secret"},
+	}}
+	NewWorker(store, *loggers.NewLogger()).Flush(context.Background())
+
+	assert.False(t, called)
+	assert.Empty(t, store.completed)
+	assert.Equal(t, []int64{1}, store.failed)
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "public", url: "https://203.0.113.10/hook"},
+		{name: "scheme", url: "ftp://203.0.113.10/hook", wantErr: true},
+		{name: "no host", url: "https:///hook", wantErr: true},
+		{name: "loopback", url: "http://127.0.0.1:8080/hook", wantErr: true},
+		{name: "localhost", url: "http://localhost/hook", wantErr: true},
+		{name: "private", url: "http://10.1.2.3/hook", wantErr: true},
+		{name: "metadata", url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{name: "unspecified", url: "http://0.0.0.0/hook", wantErr: true},
+		{name: "ipv6 loopback", url: "http://[::1]/hook", wantErr: true},
+		{name: "ipv4-mapped", url: "http://[::ffff:192.168.0.1]/hook", wantErr: true},
+		{name: "this network", url: "http://0.1.2.3/hook", wantErr: true},
+		{name: "shared address space", url: "http://100.64.0.1/hook", wantErr: true},
+		{name: "shared address space end", url: "http://100.127.255.254/hook", wantErr: true},
+		{name: "ipv4-mapped shared address space", url: "http://[::ffff:100.64.0.1]/hook", wantErr: true},
+		{name: "reserved", url: "http://240.0.0.1/hook", wantErr: true},
+		{name: "broadcast", url: "http://255.255.255.255/hook", wantErr: true},
+		{name: "nat64", url: "http://[64:ff9b::a9fe:a9fe]/hook", wantErr: true},
+		{name: "public ipv6", url: "http://[2001:4860:4860::8888]/hook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateURL(context.Background(), tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDispatcher_Handle(t *testing.T) {
+	store := &fakeStore{}
+	d := NewDispatcher(store)
+	assert.NoError(t, d.Handle(context.Background(), events.Event{ID: 7}))
+	assert.Len(t, store.enqueued, 1)
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{}`)
+	assert.Equal(t, Sign("secret", "1", body), Sign("secret", "1", body))
+	assert.NotEqual(t, Sign("secret", "1", body), Sign("secret", "2", body))
+	assert.NotEqual(t, Sign("secret", "1", body), Sign("other", "1", body))
+}
@@ -2,6 +2,8 @@ package postgresql
 
 import (
 	"context"
+	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -12,6 +14,12 @@ import (
 	"github.com/CyrilSbrodov/GopherAPIStore/cmd/loggers"
 )
 
+const (
+	connectTimeout = 5 * time.Second
+	baseRetryDelay = 500 * time.Millisecond
+	maxRetryDelay  = 30 * time.Second
+)
+
 type Client interface {
 	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
 	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
@@ -21,33 +29,126 @@ type Client interface {
 	Ping(ctx context.Context) error
 }
 
-func NewClient(ctx context.Context, maxAttempts int, cfg *config.ServerConfig, logger *loggers.Logger) (pool *pgxpool.Pool, err error) {
-	err = DoWithTries(func() error {
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+// NewClient создает пул соединений к основной БД и проверяет его доступность.
+func NewClient(ctx context.Context, maxAttempts int, cfg *config.ServerConfig, logger *loggers.Logger) (*pgxpool.Pool, error) {
+	return connect(ctx, cfg.DatabaseURI, maxAttempts, cfg, logger)
+}
+
+// NewReplicaClient создает пул соединений к реплике для запросов только на чтение.
+// Если адрес реплики не задан, возвращает nil.
+func NewReplicaClient(ctx context.Context, maxAttempts int, cfg *config.ServerConfig, logger *loggers.Logger) (*pgxpool.Pool, error) {
+	if cfg.DatabaseReplicaURI == "" {
+		return nil, nil
+	}
+	return connect(ctx, cfg.DatabaseReplicaURI, maxAttempts, cfg, logger)
+}
+
+func connect(ctx context.Context, uri string, maxAttempts int, cfg *config.ServerConfig, logger *loggers.Logger) (pool *pgxpool.Pool, err error) {
+	poolCfg, err := poolConfig(uri, cfg)
+	if err != nil {
+		logger.LogErr(err, "Failure to parse PostgreSQL config")
+		return nil, err
+	}
 
+	err = DoWithTries(ctx, func() error {
+		ctx, cancel := context.WithTimeout(ctx, connectTimeout)
 		defer cancel()
 
-		pool, err = pgxpool.New(ctx, cfg.DatabaseURI)
+		p, err := pgxpool.NewWithConfig(ctx, poolCfg)
 		if err != nil {
 			logger.LogErr(err, "Failure to connect to PostgreSQL")
+			return err
+		}
+		//пул создается лениво, поэтому доступность БД проверяем отдельно
+		if err = p.Ping(ctx); err != nil {
+			logger.LogErr(err, "Failure to ping PostgreSQL")
+			p.Close()
+			return err
 		}
+		pool = p
 		return nil
-
-	}, maxAttempts, 5*time.Second)
+	}, maxAttempts, baseRetryDelay)
 	if err != nil {
 		logger.LogErr(err, "Failure to connect to PostgreSQL")
+		return nil, err
 	}
-	return
+	return pool, nil
 }
-func DoWithTries(fn func() error, attempts int, delay time.Duration) (err error) {
-	for attempts > 0 {
-		if err = fn(); err != nil {
-			time.Sleep(delay)
-			attempts--
 
-			continue
+func poolConfig(uri string, cfg *config.ServerConfig) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DBMaxConns > 0 {
+		poolCfg.MaxConns = cfg.DBMaxConns
+	}
+	if cfg.DBMinConns > 0 {
+		poolCfg.MinConns = cfg.DBMinConns
+	}
+	if cfg.DBMaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.DBMaxConnLifetime
+	}
+	if cfg.DBMaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.DBMaxConnIdleTime
+	}
+	if cfg.DBStatementTimeout > 0 {
+		poolCfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.DBStatementTimeout.Milliseconds(), 10)
+	}
+	if cfg.DBApplicationName != "" {
+		poolCfg.ConnConfig.RuntimeParams["application_name"] = cfg.DBApplicationName
+	}
+	poolCfg.ConnConfig.Tracer = queryTracer{}
+	return poolCfg, nil
+}
+
+// DoWithTries выполняет fn до attempts раз. Пауза между попытками растет экспоненциально
+// от delay до maxRetryDelay, к ней добавляется случайный разброс, чтобы реплики сервиса
+// не переподключались одновременно. При attempts < 1 выполняется одна попытка.
+func DoWithTries(ctx context.Context, fn func() error, attempts int, delay time.Duration) (err error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
 		}
-		return nil
+		if i == attempts-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(i, delay)):
+		}
+	}
+	return err
+}
+
+func backoff(attempt int, delay time.Duration) time.Duration {
+	d := delay << attempt
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	//половина паузы фиксирована, вторая половина случайна
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Stats возвращает состояние пула соединений.
+func Stats(pool *pgxpool.Pool) map[string]interface{} {
+	s := pool.Stat()
+	return map[string]interface{}{
+		"total_conns":          s.TotalConns(),
+		"idle_conns":           s.IdleConns(),
+		"acquired_conns":       s.AcquiredConns(),
+		"constructing_conns":   s.ConstructingConns(),
+		"max_conns":            s.MaxConns(),
+		"acquire_count":        s.AcquireCount(),
+		"empty_acquire_count":  s.EmptyAcquireCount(),
+		"canceled_acquires":    s.CanceledAcquireCount(),
+		"acquire_duration_ms":  s.AcquireDuration().Milliseconds(),
+		"new_conns_count":      s.NewConnsCount(),
+		"max_lifetime_destroy": s.MaxLifetimeDestroyCount(),
+		"max_idle_destroy":     s.MaxIdleDestroyCount(),
 	}
-	return
 }